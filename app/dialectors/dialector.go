@@ -1,6 +1,14 @@
 package dialectors
 
+import "gorm.io/gorm"
+
 type Dialector interface {
 	EscapeField(fieldName string) string
 	ExposeSQLErr(err error) error
+	// LockForUpdate makes the query lock the rows it reads of the table until the end of the transaction
+	LockForUpdate(db *gorm.DB, table string) *gorm.DB
+	// NullsFirst reports whether NULL values come first in ascending order
+	NullsFirst() bool
+	// EstimateCount returns the approximate number of rows of the table from the statistics of the database
+	EstimateCount(db *gorm.DB, table string) (int64, error)
 }
@@ -1,5 +1,12 @@
 package dialectors
 
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
 type PostgresDialector struct {
 }
 
@@ -10,3 +17,22 @@ func (PostgresDialector) EscapeField(fieldName string) string {
 func (PostgresDialector) ExposeSQLErr(err error) error {
 	return nil
 }
+
+func (PostgresDialector) LockForUpdate(db *gorm.DB, table string) *gorm.DB {
+	return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+func (PostgresDialector) NullsFirst() bool {
+	return false
+}
+
+func (PostgresDialector) EstimateCount(db *gorm.DB, table string) (int64, error) {
+	var count int64
+	// The identifiers are quoted, since the names of the tables are case sensitive
+	pieces := strings.Split(table, ".")
+	for i, piece := range pieces {
+		pieces[i] = `"` + strings.ReplaceAll(strings.Trim(piece, `"`), `"`, `""`) + `"`
+	}
+	err := db.Raw("SELECT GREATEST(COALESCE((SELECT reltuples FROM pg_class WHERE oid = to_regclass(?)), 0), 0)::bigint", strings.Join(pieces, ".")).Scan(&count).Error
+	return count, err
+}
@@ -3,6 +3,9 @@ package dialectors
 import (
 	"api_core/message"
 	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SqlserverError interface {
@@ -44,3 +47,18 @@ func (SqlserverDialector) ExposeSQLErr(err error) error {
 	}
 	return nil
 }
+
+func (SqlserverDialector) LockForUpdate(db *gorm.DB, table string) *gorm.DB {
+	// SQL Server has no FOR UPDATE, the lock is a hint of the table
+	return db.Table("? WITH (UPDLOCK, ROWLOCK)", clause.Table{Name: table})
+}
+
+func (SqlserverDialector) NullsFirst() bool {
+	return true
+}
+
+func (SqlserverDialector) EstimateCount(db *gorm.DB, table string) (int64, error) {
+	var count int64
+	err := db.Raw("SELECT COALESCE(SUM(p.rows), 0) FROM sys.partitions p WHERE p.object_id = OBJECT_ID(?) AND p.index_id IN (0, 1)", table).Scan(&count).Error
+	return count, err
+}
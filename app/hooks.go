@@ -1,8 +1,6 @@
 package app
 
 import (
-	"log"
-
 	"api_core/message"
 
 	"github.com/gin-gonic/gin"
@@ -37,14 +35,13 @@ var Hooks = ControllerHooks{}
 
 func init() {
 	Hooks.AbortWithError.Add("default", func(c *gin.Context, err error) {
-		if msg, ok := err.(message.Message); ok {
-			msg.Write(c)
-		} else {
-			log.Println(err)
-			message.InternalServerError(c).Write(c)
+		// The messages are written as problem details when negotiated, see message.WantsProblem
+		if _, ok := message.AsMessage(err); !ok {
+			LoggerFrom(c).Error("request failed", "error", err)
 		}
+		message.WriteError(c, err)
 	})
 	Hooks.OnRecover.Add("default", func(c *gin.Context, err string) {
-		log.Printf("recovered panic: %s\n", err)
+		LoggerFrom(c).Error("recovered panic", "error", err)
 	})
 }
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// LoggerKey is the key of the request-scoped logger in the gin context
+const LoggerKey = "logger"
+
+type loggerContextKey struct{}
+
+// Logger is the logger of the application, the requests log through a child of it carrying their request ID
+var Logger = NewLogger(LogOptions{JSON: os.Getenv("LOG_FORMAT") == "json"})
+
+type LogOptions struct {
+	// JSON writes the records as JSON objects instead of key=value pairs
+	JSON  bool
+	Level slog.Leveler
+	// Writer defaults to the standard error
+	Writer io.Writer
+}
+
+func NewLogger(options LogOptions) *slog.Logger {
+	writer := options.Writer
+	if writer == nil {
+		writer = os.Stderr
+	}
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	if options.JSON {
+		return slog.New(slog.NewJSONHandler(writer, handlerOptions))
+	}
+	return slog.New(slog.NewTextHandler(writer, handlerOptions))
+}
+
+// ConfigureLogger replaces Logger, it's also made the default of slog so that the log package writes through it
+func ConfigureLogger(options LogOptions) {
+	Logger = NewLogger(options)
+	slog.SetDefault(Logger)
+}
+
+// ContextWithLogger returns a copy of ctx carrying the logger, retrieved by LoggerFrom
+func ContextWithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, log)
+}
+
+// LoggerFrom returns the request-scoped logger carried by ctx, which can be the gin context or one derived from it, or Logger when there is none
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if ctx == nil {
+		return Logger
+	}
+	if log, ok := ctx.Value(LoggerKey).(*slog.Logger); ok {
+		return log
+	}
+	if log, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return log
+	}
+	// Without ContextWithFallback the gin context doesn't read the values of the request context
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		if log, ok := c.Request.Context().Value(loggerContextKey{}).(*slog.Logger); ok {
+			return log
+		}
+	}
+	return Logger
+}
+
+/*
+gormLogger writes the SQL statements through the logger of the context of the statement, so that they carry the request ID.
+The failed statements are logged as errors, the ones slower than SlowThreshold as warnings and the others only with the Info level.
+*/
+type gormLogger struct {
+	logger.Config
+}
+
+// NewGormLogger returns a GORM logger writing through LoggerFrom, config.Colorful is ignored
+func NewGormLogger(config logger.Config) logger.Interface {
+	return &gormLogger{Config: config}
+}
+
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.LogLevel = level
+	return &newLogger
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.LogLevel >= logger.Info {
+		LoggerFrom(ctx).InfoContext(ctx, msg, "args", args)
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.LogLevel >= logger.Warn {
+		LoggerFrom(ctx).WarnContext(ctx, msg, "args", args)
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.LogLevel >= logger.Error {
+		LoggerFrom(ctx).ErrorContext(ctx, msg, "args", args)
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.LogLevel <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	attrs := func() []any {
+		sql, rows := fc()
+		return []any{"sql", sql, "rows", rows, "elapsed", elapsed}
+	}
+	switch {
+	case err != nil && l.LogLevel >= logger.Error && (!errors.Is(err, gorm.ErrRecordNotFound) || !l.IgnoreRecordNotFoundError):
+		LoggerFrom(ctx).ErrorContext(ctx, "sql error", append(attrs(), "error", err)...)
+	case l.SlowThreshold != 0 && elapsed > l.SlowThreshold && l.LogLevel >= logger.Warn:
+		LoggerFrom(ctx).WarnContext(ctx, "slow sql", append(attrs(), "threshold", l.SlowThreshold)...)
+	case l.LogLevel == logger.Info:
+		LoggerFrom(ctx).InfoContext(ctx, "sql", attrs()...)
+	}
+}
+
+// GormLogger logs the failed and the slow statements, set it in the gorm.Config of DB to correlate them with the requests
+var GormLogger = NewGormLogger(logger.Config{SlowThreshold: 200 * time.Millisecond, IgnoreRecordNotFoundError: true, LogLevel: logger.Warn})
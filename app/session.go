@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
 	"strings"
 	"time"
 
@@ -13,11 +11,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var provider = dbSessionProvider{}
-var no404Logger = logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{SlowThreshold: 200 * time.Millisecond, Colorful: true, IgnoreRecordNotFoundError: true, LogLevel: logger.Warn})
 
 type SessionModel struct {
 	KEY        string `gorm:"primaryKey"`
@@ -100,7 +96,7 @@ type dbSessionProvider struct{}
 
 func (sp *dbSessionProvider) retrieve(key string) *Session {
 	session := SessionModel{}
-	result := DB.Session(&gorm.Session{Logger: no404Logger}).First(&session, "\"key\" = ?", key)
+	result := DB.Session(&gorm.Session{Logger: GormLogger}).First(&session, "\"key\" = ?", key)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil
 	}
@@ -116,7 +112,7 @@ func (sp *dbSessionProvider) store(key string, s *Session) {
 		EXPIRES_AT: s.expiresAt,
 		PROPERTIES: string(props),
 	}
-	DB.Session(&gorm.Session{Logger: no404Logger}).Save(session)
+	DB.Session(&gorm.Session{Logger: GormLogger}).Save(session)
 }
 
 func (sp *dbSessionProvider) delete(key string) {
@@ -0,0 +1,347 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"api_core/request"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Redacted replaces the values of the fields tagged with audit:"redact"
+const Redacted = "***"
+
+// SubjectKey is the session property identifying who made the change
+var SubjectKey = "USERNAME"
+
+// SubjectGetter returns who made the change, by default the SubjectKey property of the session
+var SubjectGetter = func(c *gin.Context) string {
+	if request.SessionGetter == nil {
+		return ""
+	}
+	if s := request.Session(c); s != nil && s.Exists(SubjectKey) {
+		return s.GetString(SubjectKey)
+	}
+	return ""
+}
+
+type AuditModel struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement"`
+	MODEL      string `gorm:"size:100;index:IX_AUDIT_LOG_RECORD"`
+	KEYS       string `gorm:"size:255;index:IX_AUDIT_LOG_RECORD"`
+	ACTION     string `gorm:"size:10"`
+	CHANGES    string `gorm:"type:text"`
+	SUBJECT    string `gorm:"size:255"`
+	REQUEST_ID string `gorm:"size:100"`
+	CREATED_AT time.Time
+}
+
+func (AuditModel) TableName() string {
+	return "AUDIT_LOG"
+}
+
+type Change struct {
+	Field  string `json:"field"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+type Diff struct {
+	Fields    []Change         `json:"fields,omitempty"`
+	Relations []RelationChange `json:"relations,omitempty"`
+}
+
+func (d Diff) IsEmpty() bool {
+	return len(d.Fields) == 0 && len(d.Relations) == 0
+}
+
+type RelationChange struct {
+	Relation string         `json:"relation"`
+	Action   string         `json:"action"`
+	Keys     map[string]any `json:"keys"`
+	Diff
+}
+
+// Snapshot is the state of a record, along with the nested relations sent in the request
+type Snapshot struct {
+	Relations []string
+	Value     reflect.Value
+}
+
+/*
+Enabled reports whether the changes to the model are recorded.
+Auditing can be disabled by tagging an embedded struct of the model with audit:"-".
+*/
+func Enabled(modelType reflect.Type) bool {
+	for modelType.Kind() == reflect.Ptr || modelType.Kind() == reflect.Slice {
+		modelType = modelType.Elem()
+	}
+	if modelType.Kind() != reflect.Struct || modelType == reflect.TypeOf(AuditModel{}) {
+		return false
+	}
+	for i := 0; i < modelType.NumField(); i++ {
+		if field := modelType.Field(i); field.Anonymous && field.Tag.Get("audit") == "-" {
+			return false
+		}
+	}
+	return true
+}
+
+// Keys returns the primary keys of the record joined by "/", the same format used to search the history
+func Keys(modelSchema *schema.Schema, modelVal reflect.Value) string {
+	keys := make([]string, len(modelSchema.PrimaryFields))
+	for i, field := range modelSchema.PrimaryFields {
+		val, _ := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		keys[i] = fmt.Sprint(indirect(val))
+	}
+	return strings.Join(keys, "/")
+}
+
+// Take loads the current state of the record, including the has_one and has_many relations present in modelVal
+func Take(tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value) (*Snapshot, error) {
+	if !Enabled(modelSchema.ModelType) {
+		return nil, nil
+	}
+	snapshot := &Snapshot{Relations: payloadRelations(modelSchema, reflect.Indirect(modelVal), "")}
+	var err error
+	snapshot.Value, err = load(tx, modelSchema, modelVal, snapshot.Relations)
+	return snapshot, err
+}
+
+/*
+Record stores the changes made to the record in the audit table, inside the transaction of the change.
+The state after the change is loaded from the database and compared with the snapshot taken before, which is nil for creations.
+*/
+func Record(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, action string, modelVal reflect.Value, before *Snapshot) error {
+	if !Enabled(modelSchema.ModelType) {
+		return nil
+	}
+	if before == nil {
+		before = &Snapshot{Relations: payloadRelations(modelSchema, reflect.Indirect(modelVal), "")}
+	}
+	var after reflect.Value
+	if action != Delete {
+		var err error
+		after, err = load(tx, modelSchema, modelVal, before.Relations)
+		if err != nil {
+			return err
+		}
+	}
+
+	d := diff(modelSchema, before.Value, after, before.Relations)
+	if action == Update && d.IsEmpty() {
+		return nil
+	}
+	changes, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	entry := AuditModel{
+		MODEL:      modelSchema.Name,
+		KEYS:       Keys(modelSchema, modelVal),
+		ACTION:     action,
+		CHANGES:    string(changes),
+		SUBJECT:    SubjectGetter(c),
+		REQUEST_ID: request.RequestID(c),
+		CREATED_AT: time.Now(),
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&entry).Error
+}
+
+// History returns the changes recorded for the record, starting from the most recent
+func History(db *gorm.DB, modelName, keys string, scopes ...func(*gorm.DB) *gorm.DB) ([]AuditModel, int64, error) {
+	entries := []AuditModel{}
+	var count int64
+	tx := db.Model(&AuditModel{}).Where(&AuditModel{MODEL: modelName, KEYS: keys})
+	if err := tx.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	err := tx.Scopes(scopes...).Order(clause.OrderBy{Columns: []clause.OrderByColumn{
+		{Column: clause.Column{Name: db.NamingStrategy.ColumnName("", "CREATED_AT")}, Desc: true},
+		{Column: clause.Column{Name: db.NamingStrategy.ColumnName("", "ID")}, Desc: true},
+	}}).Find(&entries).Error
+	return entries, count, err
+}
+
+func load(tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value, relations []string) (reflect.Value, error) {
+	row := reflect.New(modelSchema.ModelType)
+	q := tx.Session(&gorm.Session{NewDB: true}).Model(row.Interface())
+	for _, rel := range relations {
+		q = q.Preload(rel)
+	}
+	for _, field := range modelSchema.PrimaryFields {
+		val, _ := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		q = q.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+	}
+	res := q.Limit(1).Find(row.Interface())
+	if res.Error != nil || res.RowsAffected == 0 {
+		return reflect.Value{}, res.Error
+	}
+	return row.Elem(), nil
+}
+
+// payloadRelations lists the paths of the nested has_one and has_many relations valued in the model
+func payloadRelations(modelSchema *schema.Schema, modelVal reflect.Value, prefix string) []string {
+	paths := []string{}
+	if !modelVal.IsValid() {
+		return paths
+	}
+	rels := append([]*schema.Relationship{}, modelSchema.Relationships.HasOne...)
+	rels = append(rels, modelSchema.Relationships.HasMany...)
+	for _, rel := range rels {
+		if !rel.Field.Updatable || !Enabled(rel.FieldSchema.ModelType) {
+			continue
+		}
+		items := values(rel.Field.ReflectValueOf(context.Background(), modelVal))
+		if len(items) == 0 {
+			continue
+		}
+		path := prefix + rel.Name
+		paths = append(paths, path)
+		nested := map[string]struct{}{}
+		for _, item := range items {
+			for _, p := range payloadRelations(rel.FieldSchema, item, path+".") {
+				if _, ok := nested[p]; !ok {
+					nested[p] = struct{}{}
+					paths = append(paths, p)
+				}
+			}
+		}
+	}
+	return paths
+}
+
+func diff(modelSchema *schema.Schema, before, after reflect.Value, relations []string) Diff {
+	d := Diff{}
+	for _, field := range modelSchema.Fields {
+		tag := field.Tag.Get("audit")
+		if len(field.DBName) == 0 || !field.Readable || tag == "-" {
+			continue
+		}
+		b := fieldValue(field, before)
+		a := fieldValue(field, after)
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		if tag == "redact" {
+			if b != nil {
+				b = Redacted
+			}
+			if a != nil {
+				a = Redacted
+			}
+		}
+		d.Fields = append(d.Fields, Change{Field: field.Name, Before: b, After: a})
+	}
+
+	nested := map[string][]string{}
+	names := []string{}
+	for _, rel := range relations {
+		pieces := strings.SplitN(rel, ".", 2)
+		if _, ok := nested[pieces[0]]; !ok {
+			names = append(names, pieces[0])
+			nested[pieces[0]] = []string{}
+		}
+		if len(pieces) > 1 {
+			nested[pieces[0]] = append(nested[pieces[0]], pieces[1])
+		}
+	}
+	for _, name := range names {
+		rel, ok := modelSchema.Relationships.Relations[name]
+		if !ok {
+			continue
+		}
+		var beforeItems, afterItems []reflect.Value
+		if before.IsValid() {
+			beforeItems = values(rel.Field.ReflectValueOf(context.Background(), before))
+		}
+		if after.IsValid() {
+			afterItems = values(rel.Field.ReflectValueOf(context.Background(), after))
+		}
+		beforeByKey := map[string]reflect.Value{}
+		for _, item := range beforeItems {
+			beforeByKey[Keys(rel.FieldSchema, item)] = item
+		}
+		for _, item := range afterItems {
+			key := Keys(rel.FieldSchema, item)
+			if b, ok := beforeByKey[key]; ok {
+				delete(beforeByKey, key)
+				if itemDiff := diff(rel.FieldSchema, b, item, nested[name]); !itemDiff.IsEmpty() {
+					d.Relations = append(d.Relations, RelationChange{Relation: name, Action: Update, Keys: primaryMap(rel.FieldSchema, item), Diff: itemDiff})
+				}
+			} else {
+				d.Relations = append(d.Relations, RelationChange{Relation: name, Action: Create, Keys: primaryMap(rel.FieldSchema, item), Diff: diff(rel.FieldSchema, reflect.Value{}, item, nested[name])})
+			}
+		}
+		for _, item := range beforeItems {
+			if _, ok := beforeByKey[Keys(rel.FieldSchema, item)]; ok {
+				d.Relations = append(d.Relations, RelationChange{Relation: name, Action: Delete, Keys: primaryMap(rel.FieldSchema, item), Diff: diff(rel.FieldSchema, item, reflect.Value{}, nested[name])})
+			}
+		}
+	}
+	return d
+}
+
+func primaryMap(modelSchema *schema.Schema, modelVal reflect.Value) map[string]any {
+	keys := map[string]any{}
+	for _, field := range modelSchema.PrimaryFields {
+		keys[field.Name] = fieldValue(field, modelVal)
+	}
+	return keys
+}
+
+func fieldValue(field *schema.Field, modelVal reflect.Value) any {
+	if !modelVal.IsValid() {
+		return nil
+	}
+	val, zero := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+	if zero && reflect.ValueOf(val).Kind() == reflect.Ptr {
+		return nil
+	}
+	return indirect(val)
+}
+
+// values returns the structs contained in a relation field, which can be a struct, a pointer or a slice
+func values(val reflect.Value) []reflect.Value {
+	items := []reflect.Value{}
+	val = reflect.Indirect(val)
+	if !val.IsValid() {
+		return items
+	}
+	if val.Kind() == reflect.Slice {
+		for i := 0; i < val.Len(); i++ {
+			if item := reflect.Indirect(val.Index(i)); item.IsValid() {
+				items = append(items, item)
+			}
+		}
+	} else if val.Kind() == reflect.Struct && !val.IsZero() {
+		items = append(items, val)
+	}
+	return items
+}
+
+func indirect(val any) any {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		return rv.Elem().Interface()
+	}
+	return val
+}
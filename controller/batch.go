@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"api_core/app"
+	"api_core/message"
+	"api_core/request"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Batch exposes the /batch endpoint, which executes the operations on the registered controllers inside a single transaction.
+// Register it with RegisterControllers to enable it.
+type Batch struct {
+	Controller
+}
+
+func (Batch) Endpoint() string {
+	return "batch"
+}
+
+func (Batch) Routes() []Route {
+	return []Route{
+		Post("", BatchHandler),
+	}
+}
+
+/*
+BatchOperation is a request to one of the routes of the registered controllers.
+The path and the body can reference the response of a previous operation with {{id.FIELD}}, where id is the ID of the operation or its index.
+When the whole value of a string is a reference it's replaced with the referenced value, preserving its type.
+*/
+type BatchOperation struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body"`
+}
+
+type BatchResult struct {
+	ID     string          `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchScope struct {
+	parent *gin.Context
+	tx     *gorm.DB
+}
+
+type batchScopeKey struct{}
+
+var errBatchFailed = errors.New("batch operation failed")
+var batchReference = regexp.MustCompile(`\{\{\s*([\w$-]+)((?:\.[\w$-]+)*)\s*\}\}`)
+
+var batchEngine *gin.Engine
+var batchEngineMutex sync.Mutex
+
+// resetBatchEngine discards the router of the batch operations, to be built again with the controllers registered since
+func resetBatchEngine() {
+	batchEngineMutex.Lock()
+	defer batchEngineMutex.Unlock()
+	batchEngine = nil
+}
+
+// BatchEngine returns the router dispatching the batch operations, it contains the routes of every registered controller
+func BatchEngine() *gin.Engine {
+	batchEngineMutex.Lock()
+	defer batchEngineMutex.Unlock()
+	if batchEngine == nil {
+		batchEngine = gin.New()
+		batchEngine.Use(func(c *gin.Context) {
+			scope := c.Request.Context().Value(batchScopeKey{}).(*batchScope)
+			for key, val := range scope.parent.Keys {
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, val)
+				}
+			}
+			request.WithTx(c, scope.tx)
+		})
+		for _, name := range slices.Sorted(maps.Keys(ControllerByName)) {
+			ctrl := ControllerByName[name]
+			if _, ok := ctrl.(Batch); ok {
+				continue
+			}
+			if _, ok := ctrl.(*Batch); ok {
+				continue
+			}
+			for _, route := range Routes(ctrl) {
+				handlers := []gin.HandlerFunc{}
+				if m, ok := ctrl.(Middlewarer); ok {
+					handlers = append(handlers, m.Middleware()...)
+				}
+				handlers = append(handlers, PermissionsMiddleware(route.Permissions), route.Handler)
+				addBatchRoute(route.Method, path.Clean(FullPath(ctrl)+"/"+route.Pattern), handlers)
+			}
+		}
+	}
+	return batchEngine
+}
+
+func addBatchRoute(method, pattern string, handlers []gin.HandlerFunc) {
+	// Conflicting routes can't be reached in the batch, they are reported without making every batch fail
+	defer func() {
+		if err := recover(); err != nil {
+			app.Logger.Error("batch route not registered", "method", method, "path", pattern, "error", err)
+		}
+	}()
+	batchEngine.Handle(method, pattern, handlers...)
+}
+
+/*
+BatchHandler executes an ordered list of operations inside a single transaction.
+The response contains the result of every executed operation, the first failure stops the execution and rolls back the whole batch.
+*/
+func BatchHandler(c *gin.Context) {
+	operations := []BatchOperation{}
+	jsonData, err := c.GetRawData()
+	if err != nil || len(jsonData) == 0 {
+		message.InvalidJSON(c).Write(c)
+		return
+	}
+	if AbortIfError(c, LoadModel(c, jsonData, &operations)) {
+		return
+	}
+
+	results := []BatchResult{}
+	status := http.StatusOK
+	err = request.DB(c).Transaction(func(tx *gorm.DB) error {
+		responses := map[string]any{}
+		for i, op := range operations {
+			result := BatchResult{ID: op.ID}
+			opPath, body, msg := resolveBatchReferences(c, op, responses)
+			if msg != nil {
+				result.Status = msg.(*message.Msg).Status
+				result.Body = msg.ToJSON()
+			} else {
+				result = runBatchOperation(c, tx, op.Method, opPath, body)
+				result.ID = op.ID
+			}
+			results = append(results, result)
+			if result.Status >= http.StatusBadRequest {
+				status = result.Status
+				return errBatchFailed
+			}
+
+			var response any
+			if len(result.Body) > 0 && json.Unmarshal(result.Body, &response) == nil {
+				responses[strconv.Itoa(i)] = response
+				if op.ID != "" {
+					responses[op.ID] = response
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		AbortWithError(c, err)
+		return
+	}
+	c.JSON(status, results)
+}
+
+func runBatchOperation(c *gin.Context, tx *gorm.DB, method, opPath string, body []byte) BatchResult {
+	ctx := context.WithValue(c.Request.Context(), batchScopeKey{}, &batchScope{parent: c, tx: tx})
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), opPath, bytes.NewReader(body))
+	if err != nil {
+		msg := message.RouteNotFound(c, method, opPath)
+		return BatchResult{Status: http.StatusNotFound, Body: msg.ToJSON()}
+	}
+	for key, values := range c.Request.Header {
+		switch key {
+		case "Content-Length", "Accept", "If-Match", "If-None-Match", "If-Modified-Since", IdempotencyKeyHeader:
+		default:
+			req.Header[key] = values
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	BatchEngine().ServeHTTP(recorder, req)
+	if recorder.Code == http.StatusNotFound && recorder.Body.String() == "404 page not found" {
+		msg := message.RouteNotFound(c, method, opPath)
+		return BatchResult{Status: http.StatusNotFound, Body: msg.ToJSON()}
+	}
+	return BatchResult{Status: recorder.Code, Body: recorder.Body.Bytes()}
+}
+
+// resolveBatchReferences replaces the references to the previous responses in the path and in the body of the operation
+func resolveBatchReferences(c *gin.Context, op BatchOperation, responses map[string]any) (string, []byte, message.Message) {
+	var msg message.Message
+	opPath := batchReference.ReplaceAllStringFunc(op.Path, func(ref string) string {
+		val, ok := lookupBatchReference(ref, responses)
+		if !ok {
+			msg = message.InvalidReference(c, ref)
+		}
+		return fmt.Sprint(val)
+	})
+	if msg != nil || len(op.Body) == 0 {
+		return opPath, op.Body, msg
+	}
+
+	var body any
+	if err := json.Unmarshal(op.Body, &body); err != nil {
+		return opPath, nil, message.InvalidJSON(c).Text(err.Error())
+	}
+	var resolve func(val any) any
+	resolve = func(val any) any {
+		switch v := val.(type) {
+		case map[string]any:
+			for key, item := range v {
+				v[key] = resolve(item)
+			}
+		case []any:
+			for i, item := range v {
+				v[i] = resolve(item)
+			}
+		case string:
+			if loc := batchReference.FindStringIndex(v); loc != nil && loc[0] == 0 && loc[1] == len(v) {
+				ref, ok := lookupBatchReference(v, responses)
+				if !ok {
+					msg = message.InvalidReference(c, v)
+				}
+				return ref
+			}
+			return batchReference.ReplaceAllStringFunc(v, func(ref string) string {
+				val, ok := lookupBatchReference(ref, responses)
+				if !ok {
+					msg = message.InvalidReference(c, ref)
+				}
+				return fmt.Sprint(val)
+			})
+		}
+		return val
+	}
+	body = resolve(body)
+	if msg != nil {
+		return opPath, nil, msg
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return opPath, nil, message.InvalidJSON(c).Text(err.Error())
+	}
+	return opPath, data, nil
+}
+
+func lookupBatchReference(ref string, responses map[string]any) (any, bool) {
+	match := batchReference.FindStringSubmatch(ref)
+	val, ok := responses[match[1]]
+	if !ok {
+		return nil, false
+	}
+	for _, piece := range strings.Split(strings.TrimPrefix(match[2], "."), ".") {
+		if piece == "" {
+			continue
+		}
+		switch v := val.(type) {
+		case map[string]any:
+			if val, ok = v[piece]; !ok {
+				return nil, false
+			}
+		case []any:
+			index, err := strconv.Atoi(piece)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			val = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
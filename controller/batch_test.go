@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveBatchReferences(t *testing.T) {
+	responses := map[string]any{
+		"order": map[string]any{"ID": 42.0, "CODE": "A-1", "ROWS": []any{map[string]any{"ID": 7.0}}},
+		"0":     map[string]any{"ID": 1.0},
+	}
+	tests := []struct {
+		name, path, body   string
+		wantPath, wantBody string
+		wantErr            bool
+	}{
+		{name: "path", path: "/rows/{{order.ID}}", wantPath: "/rows/42"},
+		{name: "index", path: "/rows/{{0.ID}}", wantPath: "/rows/1"},
+		{name: "whole value keeps the type", path: "/rows", body: `{"ORDER_ID":"{{order.ID}}"}`, wantPath: "/rows", wantBody: `{"ORDER_ID":42}`},
+		{name: "inside a string", path: "/rows", body: `{"NOTE":"order {{ order.CODE }}"}`, wantPath: "/rows", wantBody: `{"NOTE":"order A-1"}`},
+		{name: "nested list", path: "/rows", body: `[{"ID":"{{order.ROWS.0.ID}}"}]`, wantPath: "/rows", wantBody: `[{"ID":7}]`},
+		{name: "whole object", path: "/rows", body: `{"ORDER":"{{order}}"}`, wantPath: "/rows", wantBody: `{"ORDER":{"CODE":"A-1","ID":42,"ROWS":[{"ID":7}]}}`},
+		{name: "unknown operation", path: "/rows/{{missing.ID}}", wantErr: true},
+		{name: "unknown field", path: "/rows", body: `{"ID":"{{order.NAME}}"}`, wantErr: true},
+		{name: "index out of range", path: "/rows", body: `{"ID":"{{order.ROWS.1.ID}}"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			op := BatchOperation{Method: "POST", Path: tt.path}
+			if tt.body != "" {
+				op.Body = json.RawMessage(tt.body)
+			}
+			path, body, msg := resolveBatchReferences(c, op, responses)
+			if tt.wantErr {
+				if msg == nil {
+					t.Fatalf("expected an error, got %q %s", path, body)
+				}
+				return
+			}
+			if msg != nil {
+				t.Fatalf("unexpected error %v", msg)
+			}
+			if path != tt.wantPath {
+				t.Errorf("path = %q, want %q", path, tt.wantPath)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
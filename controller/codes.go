@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"net/http"
+
+	"api_core/message"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MessageCodes exposes the /messageCodes endpoint, which lists the codes of the error messages with their parameters and templates in every language.
+// Register it with RegisterControllers to enable it.
+type MessageCodes struct {
+	Controller
+}
+
+func (MessageCodes) Endpoint() string {
+	return "messageCodes"
+}
+
+func (MessageCodes) Routes() []Route {
+	return []Route{
+		Get("", MessageCodesHandler),
+	}
+}
+
+func MessageCodesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, message.Codes())
+}
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"api_core/app/dialectors"
+	"api_core/message"
+	"api_core/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// RowVersion is the current version of a row of a model implementing model.VersionedModel
+type RowVersion struct {
+	ETag string
+	// Column is the version column, empty when the version is a hash of the row
+	Column *schema.Field
+	// Values holds the current values of the columns used to compute the version
+	Values map[string]any
+}
+
+/*
+Guard restricts the query to the row only if it still has the same version column value, making the check atomic.
+A version hashed from the row is instead kept by the lock taken by CheckRowVersion, as comparing every column would fail on floats, rounded datetimes and text columns.
+*/
+func (v *RowVersion) Guard(tx *gorm.DB) *gorm.DB {
+	if v.Column == nil {
+		return tx
+	}
+	return tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: v.Column.DBName}, Value: v.Values[v.Column.DBName]})
+}
+
+// Matches reports if the version matches one of the entity tags, following the If-Match semantics, also the tags of the representations of the row
+func (v *RowVersion) Matches(tags []string) bool {
+	for _, tag := range tags {
+		if tag == "*" || tag == v.ETag || rowVersionTag(tag) == v.ETag {
+			return true
+		}
+	}
+	return false
+}
+
+// rowVersionTag removes from the ETag the hash of the representation appended by Conditional
+func rowVersionTag(tag string) string {
+	i := strings.LastIndex(tag, representationSeparator)
+	if i < 0 || len(tag)-i-2 != representationHashLength {
+		return tag
+	}
+	if _, err := hex.DecodeString(tag[i+1 : len(tag)-1]); err != nil {
+		return tag
+	}
+	return tag[:i] + `"`
+}
+
+// IsVersioned reports if optimistic concurrency control is enabled for the model
+func IsVersioned(mdl any) bool {
+	_, ok := mdl.(model.VersionedModel)
+	return ok
+}
+
+// ParseETags splits the value of an If-Match or If-None-Match header, unquoted tags are quoted to be compared with the ones generated
+func ParseETags(header string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 {
+			continue
+		}
+		if tag != "*" && !strings.HasSuffix(tag, `"`) {
+			tag = `"` + tag + `"`
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// PrimaryKeys returns the values of the primary fields of the model, indexed by field name
+func PrimaryKeys(modelSchema *schema.Schema, modelVal reflect.Value) map[string]any {
+	keys := map[string]any{}
+	for _, field := range modelSchema.PrimaryFields {
+		val, _ := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		keys[field.Name] = val
+	}
+	return keys
+}
+
+/*
+LoadRowVersion retrieves the current version of the row identified by keys, applying the default conditions of the model.
+It returns nil if the model isn't versioned or the row doesn't exist.
+*/
+func LoadRowVersion(db *gorm.DB, modelSchema *schema.Schema, keys map[string]any) (*RowVersion, error) {
+	return loadRowVersion(db, modelSchema, keys, false)
+}
+
+func loadRowVersion(db *gorm.DB, modelSchema *schema.Schema, keys map[string]any, lock bool) (*RowVersion, error) {
+	mdl := reflect.New(modelSchema.ModelType)
+	versioned, ok := mdl.Interface().(model.VersionedModel)
+	if !ok {
+		return nil, nil
+	}
+
+	fields := []*schema.Field{}
+	var column *schema.Field
+	if name := versioned.VersionField(); name != "" {
+		column = modelSchema.LookUpField(name)
+		if column == nil {
+			return nil, errors.New("invalid version field " + name + " for model " + modelSchema.Name)
+		}
+		fields = append(fields, column)
+	} else {
+		for _, field := range modelSchema.Fields {
+			if field.Readable && len(field.DBName) != 0 {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	cols := make([]string, len(fields))
+	for i, field := range fields {
+		cols[i] = field.DBName
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true}).Model(mdl.Interface()).Select(cols)
+	if lock {
+		dialector, err := dialectors.ByDB(db)
+		if err != nil {
+			return nil, err
+		}
+		tx = dialector.LockForUpdate(tx, modelSchema.Table)
+	}
+	for name, val := range keys {
+		if field := modelSchema.LookUpField(name); field != nil {
+			tx = tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+		}
+	}
+	if condMdl, ok := mdl.Interface().(model.ConditionsModel); ok {
+		query, args := condMdl.DefaultConditions(tx, modelSchema.Table)
+		if query != "" {
+			tx = tx.Where("("+query+")", args...)
+		}
+	}
+	res := tx.Limit(1).Find(mdl.Interface())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	version := &RowVersion{Column: column, Values: map[string]any{}}
+	hash := sha256.New()
+	for _, field := range fields {
+		val, zero := field.ValueOf(context.Background(), mdl.Elem())
+		rv := reflect.ValueOf(val)
+		if zero && rv.Kind() == reflect.Ptr {
+			val = nil
+		} else if rv.Kind() == reflect.Ptr {
+			val = rv.Elem().Interface()
+		}
+		version.Values[field.DBName] = val
+		fmt.Fprintf(hash, "%s=%v\x00", field.DBName, val)
+	}
+	if column != nil {
+		version.ETag = `"` + fmt.Sprint(version.Values[column.DBName]) + `"`
+	} else {
+		version.ETag = `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+	}
+	return version, nil
+}
+
+/*
+CheckRowVersion loads the version of the row identified by keys and compares it with the entity tags.
+The row is locked until the end of the transaction of db, so that it can't change before being written.
+It returns ItemNotFound when the row doesn't exist and PreconditionFailed when none of the tags match.
+*/
+func CheckRowVersion(c *gin.Context, db *gorm.DB, modelSchema *schema.Schema, keys map[string]any, tags []string) (*RowVersion, error) {
+	version, err := loadRowVersion(db, modelSchema, keys, true)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		return nil, message.ItemNotFound(c)
+	}
+	if !version.Matches(tags) {
+		return nil, message.PreconditionFailed(c)
+	}
+	return version, nil
+}
+
+// versionField returns the version column of the model, nil when it has none
+func versionField(modelSchema *schema.Schema) *schema.Field {
+	mdl := reflect.New(modelSchema.ModelType).Interface()
+	versioned, ok := mdl.(model.VersionedModel)
+	if !ok || versioned.VersionField() == "" {
+		return nil
+	}
+	return modelSchema.LookUpField(versioned.VersionField())
+}
+
+/*
+IncrementVersion adds the increment of the version column to the values of an update.
+A struct can't hold the increment, so it returns true when the values aren't a map and the version has to be incremented with BumpVersion after the update.
+*/
+func IncrementVersion(modelSchema *schema.Schema, values any) bool {
+	field := versionField(modelSchema)
+	if field == nil {
+		return false
+	}
+	valuesMap, ok := values.(map[string]interface{})
+	if !ok {
+		return true
+	}
+	valuesMap[field.Name] = gorm.Expr("COALESCE(?, 0) + 1", clause.Column{Table: clause.CurrentTable, Name: field.DBName})
+	return false
+}
+
+// BumpVersion increments the version column of the row
+func BumpVersion(tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value) error {
+	field := versionField(modelSchema)
+	if field == nil {
+		return nil
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Model(modelVal.Interface()).
+		UpdateColumn(field.DBName, gorm.Expr("COALESCE(?, 0) + 1", clause.Column{Table: clause.CurrentTable, Name: field.DBName})).Error
+}
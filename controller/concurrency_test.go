@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseETags(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"*", []string{"*"}},
+		{`"abc"`, []string{`"abc"`}},
+		{`abc`, []string{`"abc"`}},
+		{`"a", W/"b" , c`, []string{`"a"`, `W/"b"`, `"c"`}},
+		{" , ", []string{}},
+	}
+	for _, tt := range tests {
+		if got := ParseETags(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseETags(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRowVersionTag(t *testing.T) {
+	tests := []struct {
+		tag, want string
+	}{
+		{`"7"`, `"7"`},
+		{`"7+0123456789abcdef"`, `"7"`},
+		{`"a+b+0123456789abcdef"`, `"a+b"`},
+		// The suffix is stripped only when it's a hash of the expected length
+		{`"7+0123456789abcde"`, `"7+0123456789abcde"`},
+		{`"7+0123456789abcdeg"`, `"7+0123456789abcdeg"`},
+		{`"c+2"`, `"c+2"`},
+	}
+	for _, tt := range tests {
+		if got := rowVersionTag(tt.tag); got != tt.want {
+			t.Errorf("rowVersionTag(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestRowVersionMatches(t *testing.T) {
+	version := &RowVersion{ETag: `"7"`}
+	tests := []struct {
+		tags []string
+		want bool
+	}{
+		{[]string{`"7"`}, true},
+		{[]string{"*"}, true},
+		{[]string{`"6"`, `"7+0123456789abcdef"`}, true},
+		{[]string{`"6"`}, false},
+		{[]string{`"6+0123456789abcdef"`}, false},
+		{[]string{}, false},
+	}
+	for _, tt := range tests {
+		if got := version.Matches(tt.tags); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"api_core/model"
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+)
+
+// representationSeparator separates the version of the row from the hash of the representation in the ETag
+const representationSeparator = "+"
+
+const representationHashLength = 16
+
+// bufferedWriter holds the response in memory until it has been decided whether to send it or not
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferedWriter) Flush() {}
+
+/*
+Conditional buffers the response written by fn and answers conditional requests.
+A strong ETag is computed over the serialized body, and If-None-Match or If-Modified-Since are answered with 304 Not Modified.
+When the version of the row has already been set as ETag the hash is appended to it, so that every representation of the row has its own tag while still matching the version with If-Match.
+The Cache-Control header is set when the model implements model.CacheControlModel.
+*/
+func Conditional(c *gin.Context, mdl any, lastModified time.Time, fn func() error) error {
+	if cacheMdl, ok := mdl.(model.CacheControlModel); ok {
+		if policy := cacheMdl.CacheControl(c); policy != "" {
+			c.Header("Cache-Control", policy)
+		}
+	}
+
+	c.Writer.Header().Add("Vary", "Accept")
+	writer := c.Writer
+	buffer := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+	c.Writer = buffer
+	// The writer is restored also on panic, so that the recovery writes its response to the client
+	defer func() {
+		c.Writer = writer
+	}()
+	err := fn()
+	c.Writer = writer
+	if err != nil {
+		return err
+	}
+
+	if buffer.status == http.StatusOK {
+		hash := sha256.Sum256(buffer.body.Bytes())
+		etag := `"` + hex.EncodeToString(hash[:])[:32] + `"`
+		if version := c.Writer.Header().Get("ETag"); version != "" {
+			etag = strings.TrimSuffix(version, `"`) + representationSeparator + hex.EncodeToString(hash[:])[:representationHashLength] + `"`
+		}
+		c.Header("ETag", etag)
+		if !lastModified.IsZero() {
+			c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		}
+		if IsNotModified(c, etag, lastModified) {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.WriteHeader(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return nil
+		}
+	}
+
+	c.Writer.WriteHeader(buffer.status)
+	_, err = c.Writer.Write(buffer.body.Bytes())
+	return err
+}
+
+// IsNotModified evaluates the If-None-Match and If-Modified-Since preconditions of a GET or HEAD request
+func IsNotModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		for _, tag := range ParseETags(header) {
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if header := c.GetHeader("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		if err == nil && !lastModified.Truncate(time.Second).After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastModified returns the most recent value of the updated-at column of the model among the results, if it has been selected
+func LastModified(args *query.QueryArgs) time.Time {
+	var lastModified time.Time
+	if args.Info.Schema == nil {
+		return lastModified
+	}
+	timeType := reflect.TypeOf(time.Time{})
+	for _, field := range args.Info.Schema.Fields {
+		if field.AutoUpdateTime == 0 {
+			continue
+		}
+		for _, row := range args.Result {
+			val := reflect.Indirect(reflect.ValueOf(row[field.Name]))
+			if val.Kind() == reflect.Ptr {
+				val = val.Elem()
+			}
+			if val.IsValid() && val.Type().ConvertibleTo(timeType) {
+				if t := val.Convert(timeType).Interface().(time.Time); t.After(lastModified) {
+					lastModified = t
+				}
+			}
+		}
+		break
+	}
+	return lastModified
+}
+
+// dataModel returns an instance of the model contained in data, which can be a model or a slice of models
+func dataModel(data any) any {
+	typ := reflect.TypeOf(data)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return reflect.New(typ).Interface()
+}
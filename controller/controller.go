@@ -2,12 +2,13 @@ package controller
 
 import (
 	"api_core/app"
+	"api_core/audit"
 
 	"github.com/gin-gonic/gin"
 )
 
 func init() {
-	RegisterModels(&app.SessionModel{})
+	RegisterModels(&app.SessionModel{}, &audit.AuditModel{}, &IdempotencyModel{})
 }
 
 // Controller è il cuore della logica di business e del routing, può implementare le seguenti interfaces per estendere ed aggiungere funzionalità
@@ -61,6 +62,10 @@ type Poster interface {
 	Post(c *gin.Context)
 }
 
+type Importer interface {
+	Import(c *gin.Context)
+}
+
 type PatchHandlerer interface {
 	Patch(c *gin.Context)
 }
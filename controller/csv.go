@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api_core/datatypes"
+	"api_core/message"
+	"api_core/permissions"
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"gorm.io/gorm/schema"
+)
+
+// CSVOptions are the formats used to write values in CSV exports
+type CSVOptions struct {
+	Separator      rune
+	DecimalMark    string
+	DateFormat     string
+	DatetimeFormat string
+	// BOM prepends the UTF-8 byte order mark, which makes Excel detect the encoding
+	BOM bool
+	// Labels writes the labels of the fields in the heading instead of their names
+	Labels bool
+}
+
+// DefaultCSVOptions are used when the language of the request doesn't match any of CSVLocales
+var DefaultCSVOptions = CSVOptions{Separator: ',', DecimalMark: ",", DateFormat: "02/01/2006", DatetimeFormat: "02/01/2006 15:04", Labels: true}
+
+// CSVLocales contains the options for each language, by tag or base language
+var CSVLocales = map[string]CSVOptions{
+	"it":    {Separator: ';', DecimalMark: ",", DateFormat: "02/01/2006", DatetimeFormat: "02/01/2006 15:04", Labels: true},
+	"en":    {Separator: ',', DecimalMark: ".", DateFormat: "02/01/2006", DatetimeFormat: "02/01/2006 15:04", Labels: true},
+	"en-US": {Separator: ',', DecimalMark: ".", DateFormat: "01/02/2006", DatetimeFormat: "01/02/2006 15:04", Labels: true},
+	"de":    {Separator: ';', DecimalMark: ",", DateFormat: "02.01.2006", DatetimeFormat: "02.01.2006 15:04", Labels: true},
+	"fr":    {Separator: ';', DecimalMark: ",", DateFormat: "02/01/2006", DatetimeFormat: "02/01/2006 15:04", Labels: true},
+	"es":    {Separator: ';', DecimalMark: ",", DateFormat: "02/01/2006", DatetimeFormat: "02/01/2006 15:04", Labels: true},
+}
+
+var csvLayoutReplacer = strings.NewReplacer("yyyy", "2006", "yy", "06", "MM", "01", "dd", "02", "HH", "15", "mm", "04", "ss", "05")
+
+/*
+GetCSVOptions returns the CSV options for the language of the request, from the Accept-Language header.
+They can be overridden with the params sep, decimal, dateFormat, datetimeFormat, using the yyyy MM dd HH mm ss placeholders, bom=1 and labels=0.
+*/
+func GetCSVOptions(c *gin.Context) CSVOptions {
+	opts := DefaultCSVOptions
+	tags, _, _ := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	for _, tag := range tags {
+		if locale, ok := CSVLocales[tag.String()]; ok {
+			opts = locale
+			break
+		}
+		base, _ := tag.Base()
+		if locale, ok := CSVLocales[base.String()]; ok {
+			opts = locale
+			break
+		}
+	}
+
+	if sep := c.Query("sep"); sep != "" {
+		if sep == "\\t" {
+			opts.Separator = '\t'
+		} else {
+			opts.Separator = []rune(sep)[0]
+		}
+	}
+	if decimal := c.Query("decimal"); decimal != "" {
+		opts.DecimalMark = decimal
+	}
+	if format := c.Query("dateFormat"); format != "" {
+		opts.DateFormat = csvLayoutReplacer.Replace(format)
+	}
+	if format := c.Query("datetimeFormat"); format != "" {
+		opts.DatetimeFormat = csvLayoutReplacer.Replace(format)
+	}
+	if bom := c.Query("bom"); bom != "" {
+		opts.BOM = bom == "1"
+	}
+	if labels := c.Query("labels"); labels != "" {
+		opts.Labels = labels != "0"
+	}
+	return opts
+}
+
+// NewCSVWriter returns a writer using the separator of the options, writing the BOM first if requested
+func NewCSVWriter(w io.Writer, opts CSVOptions) *csv.Writer {
+	if opts.BOM {
+		w.Write([]byte("\xef\xbb\xbf"))
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.Separator
+	return writer
+}
+
+// csvDataInfo returns the columns of the readable fields of a struct or a slice of structs, and a row for each record
+func csvDataInfo(c *gin.Context, data any) (*query.ModelInfo, []map[string]any, error) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if !v.IsValid() {
+		return nil, nil, nil
+	}
+	if v.Kind() != reflect.Slice {
+		v = reflect.Append(reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1), v)
+	}
+	t := v.Type().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	dataSchema, err := schema.Parse(reflect.New(t).Interface(), &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &query.ModelInfo{Schema: dataSchema}
+	for _, field := range dataSchema.Fields {
+		if field.DBName != "" && field.Tag.Get("json") != "-" && permissions.CanRead(c, dataSchema, field) {
+			info.Columns = append(info.Columns, query.Column{Name: field.Name, Field: field})
+		}
+	}
+	rows := make([]map[string]any, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		if !item.IsValid() {
+			continue
+		}
+		row := make(map[string]any, len(info.Columns))
+		for _, column := range info.Columns {
+			row[column.Name], _ = column.Field.ValueOf(context.Background(), item)
+		}
+		rows = append(rows, row)
+	}
+	return info, rows, nil
+}
+
+type csvEncoder struct{}
+
+func (csvEncoder) Encode(c *gin.Context, p Payload) error {
+	opts := GetCSVOptions(c)
+	csvHeaders(c)
+	c.Status(http.StatusOK)
+	if p.Args != nil {
+		var csvData [][]string
+		l := len(p.Args.Result)
+		if l > 0 {
+
+			csvData = append(csvData, csvHeading(c, &p.Args.Info, opts))
+
+			for i := 0; i < l; i++ {
+				csvData = append(csvData, csvRecord(c, &p.Args.Info, opts, p.Args.Result[i]))
+			}
+		}
+		return NewCSVWriter(c.Writer, opts).WriteAll(csvData)
+	}
+
+	// The data that doesn't come from a query is described by the schema of its records
+	info, rows, err := csvDataInfo(c, p.Data)
+	if err != nil {
+		return err
+	}
+	var csvData [][]string
+	if len(rows) > 0 {
+		csvData = append(csvData, csvHeading(c, info, opts))
+		for _, row := range rows {
+			csvData = append(csvData, csvRecord(c, info, opts, row))
+		}
+	}
+	return NewCSVWriter(c.Writer, opts).WriteAll(csvData)
+}
+
+func (csvEncoder) StreamByDefault() bool {
+	return false
+}
+
+func (csvEncoder) Stream(c *gin.Context, args *query.QueryArgs) (RowWriter, error) {
+	opts := GetCSVOptions(c)
+	csvHeaders(c)
+	c.Status(http.StatusOK)
+	return &csvRowWriter{c: c, args: args, opts: opts, writer: NewCSVWriter(c.Writer, opts)}, nil
+}
+
+func csvHeaders(c *gin.Context) {
+	contentType, _ := NegotiateEncoder(c)
+	c.Header("Content-Type", contentType+"; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=data.csv")
+}
+
+type csvRowWriter struct {
+	c       *gin.Context
+	args    *query.QueryArgs
+	opts    CSVOptions
+	writer  *csv.Writer
+	heading bool
+}
+
+func (w *csvRowWriter) WriteRows(rows []map[string]any) error {
+	if !w.heading {
+		w.heading = true
+		if err := w.writer.Write(csvHeading(w.c, &w.args.Info, w.opts)); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if err := w.writer.Write(csvRecord(w.c, &w.args.Info, w.opts, row)); err != nil {
+			return err
+		}
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvRowWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// csvColumns returns the columns of the result in the order of sel
+func csvColumns(info *query.ModelInfo) []query.Column {
+	if len(info.Columns) > 0 {
+		return info.Columns
+	}
+	columns := []query.Column{}
+	for _, f := range info.OutputFields() {
+		columns = append(columns, query.Column{Name: f.Name, Field: info.Schema.LookUpField(f.Name)})
+	}
+	return columns
+}
+
+// csvHeading returns the heading of the CSV, the fields of the nested relations are prefixed by the relations separated by dots
+func csvHeading(c *gin.Context, info *query.ModelInfo, opts CSVOptions) []string {
+	columns := csvColumns(info)
+	heading := make([]string, len(columns))
+	for i, column := range columns {
+		pieces := []string{}
+		relSchema := info.Schema
+		for _, key := range column.Nested {
+			for _, name := range strings.Split(key, ".") {
+				label := name
+				if rel, ok := relSchema.Relationships.Relations[name]; ok {
+					relSchema = rel.FieldSchema
+					if opts.Labels {
+						label = message.Translate(c, FieldLabel(rel.Field))
+					}
+				}
+				pieces = append(pieces, label)
+			}
+		}
+		label := column.Name
+		if opts.Labels && column.Field != nil && column.Field.Name == column.Name {
+			label = message.Translate(c, FieldLabel(column.Field))
+		}
+		heading[i] = strings.Join(append(pieces, label), ".")
+	}
+	return heading
+}
+
+// csvRecord formats a row of the result, the fields of the nested relations with many records contain a value per line
+func csvRecord(c *gin.Context, info *query.ModelInfo, opts CSVOptions, item map[string]any) []string {
+	columns := csvColumns(info)
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		items := []map[string]any{item}
+		for _, key := range column.Nested {
+			key = key[strings.LastIndex(key, ".")+1:]
+			nested := []map[string]any{}
+			for _, parent := range items {
+				switch v := parent[key].(type) {
+				case []map[string]any:
+					nested = append(nested, v...)
+				case map[string]any:
+					if v != nil {
+						nested = append(nested, v)
+					}
+				}
+			}
+			items = nested
+		}
+		values := make([]string, len(items))
+		for j, nested := range items {
+			values[j] = opts.Format(c, nested[column.Name])
+		}
+		row[i] = strings.Join(values, "\n")
+	}
+	return row
+}
+
+// Format converts a value to text, datetimes are written in the timezone of the Timezone header and as dates with the Only-Date header
+func (opts CSVOptions) Format(c *gin.Context, val any) string {
+	rv := reflect.ValueOf(val)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return ""
+	}
+	switch v := rv.Interface().(type) {
+	case datatypes.Date:
+		return time.Time(v).Format(opts.DateFormat)
+	case datatypes.Datetime:
+		return opts.formatTime(c, time.Time(v))
+	case time.Time:
+		return opts.formatTime(c, v)
+	case string:
+		return v
+	}
+	switch rv.Kind() {
+	case reflect.Float32:
+		return strings.Replace(strconv.FormatFloat(rv.Float(), 'f', -1, 32), ".", opts.DecimalMark, 1)
+	case reflect.Float64:
+		return strings.Replace(strconv.FormatFloat(rv.Float(), 'f', -1, 64), ".", opts.DecimalMark, 1)
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+func (opts CSVOptions) formatTime(c *gin.Context, t time.Time) string {
+	if c.GetHeader("Only-Date") != "" {
+		return t.Format(opts.DateFormat)
+	}
+	if loc, err := time.LoadLocation(c.GetHeader("Timezone")); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format(opts.DatetimeFormat)
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"api_core/app/dialectors"
+	"api_core/audit"
 	"api_core/message"
 	"api_core/model"
 	"api_core/permissions"
@@ -37,7 +38,7 @@ func CreateToDb(c *gin.Context, db *gorm.DB, model interface{}, args ...string)
 
 	modelSchema, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
 	if err != nil {
-		message.InternalServerError(c)
+		return message.InternalServerError(c)
 	}
 
 	modelsSlice := reflect.Indirect(reflect.ValueOf(model))
@@ -57,21 +58,51 @@ func CreateToDb(c *gin.Context, db *gorm.DB, model interface{}, args ...string)
 			return msg
 		}
 	}
-	tx := db.Session(&gorm.Session{SkipDefaultTransaction: true}).Begin()
-	tx = tx.Create(model)
-	if tx.Error != nil {
-		tx.Rollback()
-		dialector, err := dialectors.ByDB(db)
-		if err != nil {
+	err = db.Session(&gorm.Session{SkipDefaultTransaction: true}).Transaction(func(tx *gorm.DB) error {
+		records := []reflect.Value{modelsSlice}
+		if modelsSlice.Type().Kind() == reflect.Slice {
+			records = make([]reflect.Value, modelsSlice.Len())
+			for i := range records {
+				records[i] = modelsSlice.Index(i)
+			}
+		}
+		if err := CheckUniqueFields(c, tx, modelSchema, records, nil); err != nil {
 			return err
 		}
-		return dialector.ExposeSQLErr(tx.Error)
-	} else {
-		tx.Commit()
+		res := omitMany2Many(tx, modelSchema).Create(model)
+		if res.Error != nil {
+			dialector, err := dialectors.ByDB(db)
+			if err != nil {
+				return err
+			}
+			if err := dialector.ExposeSQLErr(res.Error); err != nil {
+				return err
+			}
+			return res.Error
+		}
+		if modelsSlice.Type().Kind() == reflect.Slice {
+			for i := 0; i < modelsSlice.Len(); i++ {
+				if err := SaveMany2Many(c, tx, modelsSlice.Index(i), modelSchema); err != nil {
+					return err
+				}
+				err := audit.Record(c, tx, modelSchema, audit.Create, modelsSlice.Index(i), nil)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := SaveMany2Many(c, tx, modelsSlice, modelSchema); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, modelSchema, audit.Create, modelsSlice, nil)
+	})
+	if err != nil {
+		return err
 	}
 
 	if len(args) == 0 {
-		c.JSON(http.StatusOK, model)
+		return WriteSaved(c, model)
 	}
 	return nil
 }
@@ -95,26 +126,80 @@ func UpdateToDb(c *gin.Context, model interface{}, values any) error {
 		}
 	}
 
-	tx := db.Session(&gorm.Session{FullSaveAssociations: true, SkipDefaultTransaction: true}).Begin()
 	v := reflect.ValueOf(model)
-	err = DeleteRelations(c, tx, v, modelSchema)
+	keys := PrimaryKeys(modelSchema, v)
+	err = db.Session(&gorm.Session{FullSaveAssociations: true, SkipDefaultTransaction: true}).Transaction(func(tx *gorm.DB) error {
+		// The rows out of the scope of the request can't be updated, as they can't be read
+		if err := CheckNestedScope(c, tx, modelSchema, v); err != nil {
+			return err
+		}
+		var version *RowVersion
+		if tags := ParseETags(c.GetHeader("If-Match")); len(tags) > 0 && IsVersioned(model) {
+			var err error
+			version, err = CheckRowVersion(c, tx, modelSchema, keys, tags)
+			if err != nil {
+				return err
+			}
+		}
+
+		record, changed, err := mergedRecord(tx, modelSchema, v, values)
+		if err != nil {
+			return err
+		}
+		if err := CheckUniqueFields(c, tx, modelSchema, []reflect.Value{record}, []map[string]struct{}{changed}); err != nil {
+			return err
+		}
+
+		snapshot, err := audit.Take(tx, modelSchema, v)
+		if err != nil {
+			return err
+		}
+		err = DeleteRelations(c, tx, v, modelSchema)
+		if err != nil {
+			return err
+		}
+		bump := IncrementVersion(modelSchema, values)
+		upd := omitMany2Many(WithScope(tx.Model(model), modelSchema), modelSchema)
+		if version != nil {
+			upd = version.Guard(upd)
+		}
+		upd = upd.Updates(values)
+		if upd.Error != nil {
+			return upd.Error
+		}
+		if upd.RowsAffected == 0 {
+			if version != nil {
+				return message.PreconditionFailed(c)
+			}
+			return message.ItemNotFound(c)
+		}
+		if bump {
+			if err := BumpVersion(tx, modelSchema, v); err != nil {
+				return err
+			}
+		}
+		if err := SaveMany2Many(c, tx, v, modelSchema); err != nil {
+			return err
+		}
+		err = audit.Record(c, tx, modelSchema, audit.Update, v, snapshot)
+		if err != nil {
+			return err
+		}
+		if IsVersioned(model) {
+			version, err = LoadRowVersion(tx, modelSchema, keys)
+			if err != nil {
+				return err
+			}
+			if version != nil {
+				c.Header("ETag", version.ETag)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
-	if tx.Error != nil {
-		tx.Rollback()
-		return err
-	}
-	tx = tx.Model(model).Updates(values)
-	if tx.Error != nil {
-		tx.Rollback()
-		return err
-	} else {
-		tx.Commit()
-	}
-	c.JSON(http.StatusOK, model)
-	return nil
+	return WriteSaved(c, model)
 }
 
 func DeleteFromDb(c *gin.Context, models []any) error {
@@ -123,33 +208,67 @@ func DeleteFromDb(c *gin.Context, models []any) error {
 	}
 
 	db := request.DB(c)
-	tx := db.Begin()
 
 	modelSchema, err := schema.Parse(models[0], &sync.Map{}, db.NamingStrategy)
 	if err != nil {
 		return message.InternalServerError(c)
 	}
 
-	for _, mdl := range models {
-		tx := tx.Session(&gorm.Session{SkipDefaultTransaction: true})
+	tags := ParseETags(c.GetHeader("If-Match"))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, mdl := range models {
+			tx := tx.Session(&gorm.Session{SkipDefaultTransaction: true})
 
-		if condMdl, ok := mdl.(model.ConditionsModel); ok {
-			query, args := condMdl.DefaultConditions(db, modelSchema.Table)
-			if query != "" {
-				tx = tx.Where("("+query+")", args...)
+			if err := CheckScope(c, tx, modelSchema, reflect.ValueOf(mdl)); err != nil {
+				return err
+			}
+			var version *RowVersion
+			if len(tags) > 0 && IsVersioned(mdl) {
+				var err error
+				version, err = CheckRowVersion(c, tx, modelSchema, PrimaryKeys(modelSchema, reflect.ValueOf(mdl)), tags)
+				if err != nil {
+					return err
+				}
 			}
-		}
 
-		LoadForeignKeys(tx, reflect.ValueOf(mdl), modelSchema)
-		res := tx.Delete(mdl)
-		if res.Error != nil {
-			tx.Rollback()
-			return res.Error
+			tx = WithScope(tx, modelSchema)
+
+			snapshot, err := audit.Take(tx, modelSchema, reflect.ValueOf(mdl))
+			if err != nil {
+				return err
+			}
+
+			LoadForeignKeys(tx, reflect.ValueOf(mdl), modelSchema)
+			// The records referencing the one to delete block it, unless their relation cascades
+			if err := DeleteReferences(c, tx, modelSchema, reflect.ValueOf(mdl)); err != nil {
+				return err
+			}
+			if version != nil {
+				tx = version.Guard(tx)
+			}
+			res := tx.Delete(mdl)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				if version != nil {
+					return message.PreconditionFailed(c)
+				}
+				return message.ItemNotFound(c)
+			}
+			if snapshot != nil && snapshot.Value.IsValid() {
+				err = audit.Record(c, tx, modelSchema, audit.Delete, reflect.ValueOf(mdl), snapshot)
+				if err != nil {
+					return err
+				}
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	tx.Commit()
-
 	c.Status(http.StatusOK)
 	return nil
 }
@@ -370,23 +489,28 @@ func ErrorsToMsg(c *gin.Context, errors []string) message.Message {
 	return nil
 }
 
-func DeleteModels(db *gorm.DB, models interface{}) (err error) {
-	var wg sync.WaitGroup
+// DeleteModels deletes the records of the slice in order inside a single transaction, checking the records that reference them like DeleteFromDb
+func DeleteModels(db *gorm.DB, models interface{}) error {
 	val := reflect.ValueOf(models).Elem()
-	l := val.Len()
-	for i := 0; i < l; i++ {
-		wg.Add(1)
-		go func(i int) {
-			c := request.Gin(db)
-			defer Recover(c)
-			// TODO: LoadForeignKeys should be placed here
-			res := db.Delete(val.Index(i).Addr().Interface())
-			if res.Error != nil {
-				err = res.Error
-			}
-			wg.Done()
-		}(i)
+	if val.Len() == 0 {
+		return nil
 	}
-	wg.Wait()
-	return
+	modelSchema, err := schema.Parse(val.Index(0).Addr().Interface(), &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return err
+	}
+	c := request.Gin(db)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < val.Len(); i++ {
+			mdl := val.Index(i).Addr()
+			LoadForeignKeys(tx, mdl, modelSchema)
+			if err := DeleteReferences(c, tx, modelSchema, mdl); err != nil {
+				return err
+			}
+			if err := tx.Delete(mdl.Interface()).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
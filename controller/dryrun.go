@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"errors"
+
+	"api_core/request"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const DryRunHeader = "Dry-Run"
+
+// IsDryRun reports whether the write has been requested as a preview, with the dryRun=1 param or the Dry-Run header
+func IsDryRun(c *gin.Context) bool {
+	switch c.GetHeader(DryRunHeader) {
+	case "1", "true":
+		return true
+	}
+	return c.Query("dryRun") == "1"
+}
+
+/*
+DryRun executes the write handler inside a transaction that is always rolled back when the request is a dry run.
+The whole pipeline runs as in the real call, including the SQL, so the response is the same with the Dry-Run header added.
+*/
+func DryRun(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsDryRun(c) {
+			handler(c)
+			return
+		}
+		c.Header(DryRunHeader, "1")
+		parent, hasParent := c.Get(request.TxKey)
+		err := request.DB(c).Transaction(func(tx *gorm.DB) error {
+			request.WithTx(c, tx)
+			handler(c)
+			return errRollback
+		})
+		if hasParent {
+			request.WithTx(c, parent.(*gorm.DB))
+		} else {
+			delete(c.Keys, request.TxKey)
+		}
+		if err != nil && !errors.Is(err, errRollback) && !c.Writer.Written() {
+			AbortWithError(c, err)
+		}
+	}
+}
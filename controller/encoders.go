@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+const (
+	JSONContentType    = "application/json"
+	NDJSONContentType  = "application/x-ndjson"
+	MsgPackContentType = "application/msgpack"
+)
+
+// Payload is the content of a response, either the result of a query or generic data
+type Payload struct {
+	// Args is set when the payload is the result of a query, Data then contains its rows or the single row requested by primary keys
+	Args  *query.QueryArgs
+	Data  any
+	Links PageLinks
+	Count int64
+	// NextCursor and PrevCursor are set with the cursor pagination
+	NextCursor string
+	PrevCursor string
+}
+
+// Wrapped returns the data along with the pagination metadata, as sent with the wrap param
+func (p Payload) Wrapped() Response {
+	return Response{Data: p.Data, Next: p.Links.Next, Prev: p.Links.Prev, First: p.Links.First, Last: p.Links.Last, Count: p.Count, NextCursor: p.NextCursor, PrevCursor: p.PrevCursor}
+}
+
+// Encoder writes the payload of a response in a content type
+type Encoder interface {
+	Encode(c *gin.Context, p Payload) error
+}
+
+// EncoderFunc adapts a function to the Encoder interface
+type EncoderFunc func(c *gin.Context, p Payload) error
+
+func (fn EncoderFunc) Encode(c *gin.Context, p Payload) error {
+	return fn(c, p)
+}
+
+// StreamEncoder is an Encoder able to write the rows of a query while they are read, see StreamQueryResult
+type StreamEncoder interface {
+	Encoder
+	// StreamByDefault reports whether the lists are streamed even without stream=1
+	StreamByDefault() bool
+	// Stream prepares the response, it's called before writing the first rows, while the status can still be set
+	Stream(c *gin.Context, args *query.QueryArgs) (RowWriter, error)
+}
+
+// RowWriter writes the rows of a streamed response
+type RowWriter interface {
+	WriteRows(rows []map[string]any) error
+	// Close completes the response
+	Close() error
+}
+
+var encoders = map[string]Encoder{}
+var encoderTypes = []string{}
+
+/*
+RegisterEncoder makes the content type available through the Accept header, replacing the encoder already registered for it.
+The first media type of the Accept header selects the encoder, JSON is used when no encoder matches it.
+*/
+func RegisterEncoder(contentType string, encoder Encoder) {
+	if _, ok := encoders[contentType]; !ok {
+		encoderTypes = append(encoderTypes, contentType)
+	}
+	encoders[contentType] = encoder
+}
+
+// EncoderTypes returns the registered content types, in order of registration
+func EncoderTypes() []string {
+	return append([]string{}, encoderTypes...)
+}
+
+// NegotiateEncoder returns the content type and the encoder requested with the Accept header
+func NegotiateEncoder(c *gin.Context) (string, Encoder) {
+	accept := c.GetHeader("Accept")
+	if encoder, ok := encoders[accept]; ok {
+		return accept, encoder
+	}
+	mediaType := strings.TrimSpace(strings.SplitN(strings.SplitN(accept, ",", 2)[0], ";", 2)[0])
+	if encoder, ok := encoders[strings.ToLower(mediaType)]; ok {
+		return strings.ToLower(mediaType), encoder
+	}
+	return JSONContentType, encoders[JSONContentType]
+}
+
+// Encode writes the payload with the encoder requested by the Accept header
+func Encode(c *gin.Context, p Payload) error {
+	_, encoder := NegotiateEncoder(c)
+	return encoder.Encode(c, p)
+}
+
+func init() {
+	RegisterEncoder(JSONContentType, jsonEncoder{})
+	RegisterEncoder("application/csv", csvEncoder{})
+	RegisterEncoder("text/csv", csvEncoder{})
+	RegisterEncoder(XLSXContentType, EncoderFunc(encodeXLSX))
+	RegisterEncoder("application/xml", EncoderFunc(encodeXML))
+	RegisterEncoder("text/xml", EncoderFunc(encodeXML))
+	RegisterEncoder(NDJSONContentType, ndjsonEncoder{})
+	RegisterEncoder(MsgPackContentType, EncoderFunc(encodeMsgPack))
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(c *gin.Context, p Payload) error {
+	if len(c.Query("wrap")) > 0 {
+		c.JSON(http.StatusOK, p.Wrapped())
+	} else {
+		c.JSON(http.StatusOK, p.Data)
+	}
+	return nil
+}
+
+func (jsonEncoder) StreamByDefault() bool {
+	return false
+}
+
+func (jsonEncoder) Stream(c *gin.Context, args *query.QueryArgs) (RowWriter, error) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	_, err := c.Writer.WriteString("[")
+	return &jsonRowWriter{c: c, first: true}, err
+}
+
+type jsonRowWriter struct {
+	c     *gin.Context
+	first bool
+}
+
+func (w *jsonRowWriter) WriteRows(rows []map[string]any) error {
+	for _, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if !w.first {
+			w.c.Writer.WriteString(",")
+		}
+		w.first = false
+		if _, err := w.c.Writer.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *jsonRowWriter) Close() error {
+	_, err := w.c.Writer.WriteString("]")
+	return err
+}
+
+// ndjsonEncoder writes a JSON document per line, lists are always streamed
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Encode(c *gin.Context, p Payload) error {
+	c.Header("Content-Type", NDJSONContentType+"; charset=utf-8")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	v := reflect.Indirect(reflect.ValueOf(p.Data))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return encoder.Encode(p.Data)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := encoder.Encode(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonEncoder) StreamByDefault() bool {
+	return true
+}
+
+func (ndjsonEncoder) Stream(c *gin.Context, args *query.QueryArgs) (RowWriter, error) {
+	c.Header("Content-Type", NDJSONContentType+"; charset=utf-8")
+	c.Status(http.StatusOK)
+	return ndjsonRowWriter{encoder: json.NewEncoder(c.Writer)}, nil
+}
+
+type ndjsonRowWriter struct {
+	encoder *json.Encoder
+}
+
+func (w ndjsonRowWriter) WriteRows(rows []map[string]any) error {
+	for _, row := range rows {
+		if err := w.encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonRowWriter) Close() error {
+	return nil
+}
+
+func encodeXLSX(c *gin.Context, p Payload) error {
+	if p.Args != nil {
+		return WriteXLSX(c, QueryMapWorkbook(c, &p.Args.Info, p.Args.Result))
+	}
+	return WriteXLSX(c, DataWorkbook(c, p.Data))
+}
+
+// encodeMsgPack writes the same structure of the JSON response, the custom JSON representations of the values are preserved
+func encodeMsgPack(c *gin.Context, p Payload) error {
+	var data any = p.Data
+	if len(c.Query("wrap")) > 0 {
+		data = p.Wrapped()
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	c.Render(http.StatusOK, render.MsgPack{Data: msgPackValue(value)})
+	return nil
+}
+
+// msgPackValue converts the numbers decoded from JSON to integers when possible
+func msgPackValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = msgPackValue(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = msgPackValue(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"api_core/message"
+	"api_core/permissions"
+	"api_core/request"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/schema"
+)
+
+/*
+CheckWritableFields rejects the JSON body of a write containing fields, also of the nested relations, that can't be written in the request.
+The primary keys are always accepted, since they identify the records to update.
+*/
+func CheckWritableFields(c *gin.Context, model any, jsonData []byte) error {
+	modelSchema, err := schema.Parse(model, &sync.Map{}, request.DB(c).NamingStrategy)
+	if err != nil {
+		return err
+	}
+	var body any
+	if err := json.Unmarshal(jsonData, &body); err != nil {
+		return message.InvalidJSON(c).Text(err.Error())
+	}
+	fields := map[string]struct{}{}
+	readOnlyFields(c, modelSchema, "", body, fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return message.ReadOnlyFields(c, names...)
+}
+
+func readOnlyFields(c *gin.Context, modelSchema *schema.Schema, prefix string, value any, fields map[string]struct{}) {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			readOnlyFields(c, modelSchema, prefix, item, fields)
+		}
+	case map[string]any:
+		for key, val := range v {
+			if rel, ok := modelSchema.Relationships.Relations[key]; ok {
+				readOnlyFields(c, rel.FieldSchema, prefix+key+".", val, fields)
+			} else if field := jsonField(modelSchema, key); field != nil && !field.PrimaryKey && !permissions.CanWrite(c, modelSchema, field) {
+				fields[prefix+key] = struct{}{}
+			}
+		}
+	}
+}
+
+// jsonField finds the field by name or by the name of its json tag
+func jsonField(modelSchema *schema.Schema, key string) *schema.Field {
+	if field := modelSchema.LookUpField(key); field != nil {
+		return field
+	}
+	for _, field := range modelSchema.Fields {
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name == key {
+			return field
+		}
+	}
+	return nil
+}
@@ -4,11 +4,11 @@ import (
 	"api_core/message"
 	"api_core/model"
 	"api_core/permissions"
+	"api_core/request"
 	"api_core/utils"
 	"encoding/base64"
 	"fmt"
 	"io/fs"
-	"log"
 	"net/http"
 	"os"
 	"path"
@@ -80,7 +80,7 @@ func Folder(pathFunc func(*gin.Context) string) func(*gin.Context) {
 		})
 
 		if err != nil {
-			log.Printf("Error walking the path %q: %v\n", basePath, err)
+			request.Logger(c).Error("walking the folder", "path", basePath, "error", err)
 		}
 		if detailed != "" {
 			c.JSON(http.StatusOK, gin.H{"files": filesDetailed})
@@ -169,7 +169,7 @@ func PostFile(pathFunc func(*gin.Context) string) func(*gin.Context) {
 				file, err := c.FormFile("file" + strconv.Itoa(i))
 				if err != nil {
 					message.BadRequest(c).Text(err.Error()).Abort(c)
-					log.Println(err)
+					request.Logger(c).Warn("reading the uploaded file", "error", err)
 					return
 				}
 				newFileName := file.Filename
@@ -183,7 +183,7 @@ func PostFile(pathFunc func(*gin.Context) string) func(*gin.Context) {
 			file, err := c.FormFile("file")
 			if err != nil {
 				message.BadRequest(c).Text(err.Error()).Write(c)
-				log.Println(err)
+				request.Logger(c).Warn("reading the uploaded file", "error", err)
 				return
 			}
 			newFileName := file.Filename
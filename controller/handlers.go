@@ -2,26 +2,36 @@ package controller
 
 import (
 	"api_core/app/dialectors"
-	"api_core/datatypes"
+	"api_core/message"
 	"api_core/query"
-	"encoding/csv"
-	"encoding/json"
+	"api_core/request"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
 type Response struct {
 	Data  interface{}
 	Next  string
+	Prev  string `json:",omitempty"`
+	First string `json:",omitempty"`
+	Last  string `json:",omitempty"`
 	Count int64
+	// NextCursor and PrevCursor are the cursors of the adjacent pages with the cursor pagination
+	NextCursor string `json:",omitempty"`
+	PrevCursor string `json:",omitempty"`
 }
 
 func HandleGet(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, model any) error {
@@ -39,16 +49,33 @@ func HandleGet(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, mo
 		P:         c.Query("p"),
 		PagStart:  c.Query("pagStart"),
 		PagEnd:    c.Query("pagEnd"),
+		Limit:     c.Query("limit"),
+		Cursor:    c.Query("cursor"),
+		CountMode: c.Query("count"),
 		Ord:       c.Query("ord"),
 		Primaries: primaries,
 		Model:     model,
 	}
+	if len(primaries) == 0 && IsStreamRequest(c) {
+		return StreamQueryResult(c, db, &args, query.QueryConfig{
+			Dialector: dialector,
+		})
+	}
 	err = query.Query(c, db, &args, query.QueryConfig{
 		Dialector: dialector,
 	})
 	if err != nil {
 		return err
 	}
+	if len(primaries) > 0 && IsVersioned(model) {
+		version, err := LoadRowVersion(db, args.Info.Schema, primaries)
+		if err != nil {
+			return err
+		}
+		if version != nil {
+			c.Header("ETag", version.ETag)
+		}
+	}
 	err = WriteQueryMapResult(c, &args)
 	if err != nil {
 		return err
@@ -56,227 +83,148 @@ func HandleGet(c *gin.Context, db *gorm.DB, primaries map[string]interface{}, mo
 	return nil
 }
 
-func WriteQueryMapResult(c *gin.Context, args *query.QueryArgs) error {
-	c.Header("X-Total-Count", strconv.Itoa(int(args.Count)))
-	var link string
-	if query.ShouldPaginate(args.PagStart, args.PagEnd) {
-		limit := query.GetLimit(args.PagStart, args.PagEnd)
-		start := query.GetOffset(args.PagStart) + limit
-		end := start + limit
-		if int64(end) < args.Count {
-			var params []string
-			for key, values := range c.Request.URL.Query() {
-				switch key {
-				case "pagStart":
-					params = append(params, key+"="+strconv.Itoa(start))
-				case "pagEnd":
-					params = append(params, key+"="+strconv.Itoa(end))
-				default:
-					params = append(params, key+"="+strings.Join(values, "&"+key+"="))
-				}
-			}
-			link = c.FullPath() + "?" + strings.Join(params, "&")
-			c.Header("Link", link)
-		}
+/*
+WriteSaved writes the records saved by a POST or PATCH, a single record or a slice.
+With the sel or rel params the records are read again with one query by primary keys, to be returned in the same shape as a GET with the values computed by the database.
+A record that can't be read back, for example because it's out of the scope of the request, is left out of a slice, while a single record is returned as saved.
+*/
+func WriteSaved(c *gin.Context, model any) error {
+	if c.Query("sel") == "" && c.Query("rel") == "" {
+		c.JSON(http.StatusOK, model)
+		return nil
+	}
+	db := request.DB(c)
+	dialector, err := dialectors.ByDB(db)
+	if err != nil {
+		return err
+	}
+	modelSchema, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return err
 	}
-	switch c.GetHeader("Accept") {
-	case "application/csv", "text/csv":
-		c.Header("Content-Type", c.GetHeader("Accept")+"; charset=utf-8")
-		c.Header("Content-Disposition", "attachment; filename=data.csv")
-		c.Status(http.StatusOK)
-
-		// TODO: Done but needs better checking; sorting based on the input select
-		// TODO: Manage the CSV in the correct order
 
-		var csvData [][]string
-		tmz := c.GetHeader("Timezone")
-		var heading []string
-		for _, f := range args.Info.Fields {
-			heading = append(heading, f.Name)
+	val := reflect.Indirect(reflect.ValueOf(model))
+	records := []reflect.Value{val}
+	if val.Kind() == reflect.Slice {
+		records = make([]reflect.Value, val.Len())
+		for i := range records {
+			records[i] = reflect.Indirect(val.Index(i))
 		}
-		for key := range args.Info.Nested {
-			heading = append(heading, key)
-		}
-		// for i := range heading {
-		// 	if strings.Contains(heading[i], "AS") {
-		// 		s := strings.Split(heading[i], "AS")
-		// 		heading[i] = strings.TrimSpace(s[len(s)-1])
-		// 	}
-		// }
-		l := len(args.Result)
-		if l > 0 {
-
-			csvData = append(csvData, heading)
+	}
 
-			for i := 0; i < l; i++ {
-				item := args.Result[i]
-				var row []string
-				for _, f := range args.Info.Fields {
-					rv := reflect.ValueOf(item[f.Name])
-					if rv.IsValid() && !rv.IsZero() && !rv.IsNil() {
-						t := reflect.Indirect(rv)
-						if t.Type().Kind() == reflect.Ptr {
-							t = t.Elem()
-						}
-						f := t.Interface()
-						if f != nil && f != "" {
-							if date, ok := f.(datatypes.Date); ok {
-								row = append(row, time.Time(date).Format("02/01/2006"))
-							} else if datetime, ok := f.(datatypes.Datetime); ok {
-								if c.GetHeader("Only-Date") == "" {
-									loc, _ := time.LoadLocation(tmz)
-									row = append(row, time.Time(datetime).In(loc).Format("02/01/2006 15:04"))
-								} else {
-									row = append(row, time.Time(datetime).Format("02/01/2006"))
-								}
-							} else if _, ok := f.(datatypes.RoundedFloat); ok {
-								row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
-							} else if _, ok := f.(float32); ok {
-								row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
-							} else if _, ok := f.(float64); ok {
-								row = append(row, strings.ReplaceAll(fmt.Sprint(f), ".", ","))
-							} else {
-								if _, ok := f.(string); ok {
-									row = append(row, fmt.Sprintf("%s", f))
-								} else {
-									row = append(row, fmt.Sprint(f))
-								}
-							}
-						} else {
-							row = append(row, "")
-						}
-					} else {
-						row = append(row, "")
-					}
-				}
-				for key := range args.Info.Nested {
-					data, err := json.Marshal(item[key])
-					if err != nil {
-						return err
-					}
-					row = append(row, string(data))
-				}
-				csvData = append(csvData, row)
-			}
+	// The primary keys are selected with reserved aliases, the sel may not contain them and they are needed to match the rows with the records
+	sel := c.Query("sel")
+	if sel == "" {
+		sel = "*"
+	}
+	aliases := make([]string, len(modelSchema.PrimaryFields))
+	primaries := map[string]interface{}{}
+	for i, field := range modelSchema.PrimaryFields {
+		aliases[i] = savedKeyAlias + strconv.Itoa(i)
+		sel += "," + field.Name + " AS " + aliases[i]
+		values := make([]any, len(records))
+		for j, record := range records {
+			values[j], _ = field.ValueOf(context.Background(), record)
 		}
-		if err := csv.NewWriter(c.Writer).WriteAll(csvData); err != nil {
-			return err
+		primaries[field.DBName] = values
+	}
+	args := query.QueryArgs{
+		Sel:       sel,
+		Rel:       c.Query("rel"),
+		Primaries: primaries,
+		Model:     reflect.New(modelSchema.ModelType).Interface(),
+	}
+	err = query.Query(c, db, &args, query.QueryConfig{Dialector: dialector})
+	var msg *message.Msg
+	if err != nil && !(errors.As(err, &msg) && msg.Status == http.StatusNotFound) {
+		return err
+	}
+
+	// With a composite key the IN conditions can match more rows than the saved ones, which are discarded here
+	byKey := make(map[string]map[string]any, len(args.Result))
+	for _, row := range args.Result {
+		keys := make([]any, len(aliases))
+		for i, alias := range aliases {
+			keys[i] = row[alias]
+			delete(row, alias)
 		}
-	case "application/xml", "text/xml":
-		if reflect.TypeOf(args.Result).Name() == "" || len(c.Query("wrap")) > 0 {
-			c.XML(http.StatusOK, Response{Data: args.Result, Next: link, Count: args.Count})
-		} else {
-			c.XML(http.StatusOK, args.Result)
+		byKey[fmt.Sprint(keys...)] = row
+	}
+	rows := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		keys := make([]any, len(modelSchema.PrimaryFields))
+		for i, field := range modelSchema.PrimaryFields {
+			keys[i], _ = field.ValueOf(context.Background(), record)
 		}
-	default:
-		var result any = args.Result
-		if len(args.Primaries) != 0 {
-			result = args.Result[0]
-			// TODO: It might be advisable to set Count to 1 in this situation
+		if row, ok := byKey[fmt.Sprint(keys...)]; ok {
+			rows = append(rows, row)
 		}
-		if len(c.Query("wrap")) > 0 {
-			c.JSON(http.StatusOK, Response{Data: result, Next: link, Count: args.Count})
-		} else {
-			c.JSON(http.StatusOK, result)
+	}
+	columns := args.Info.Columns[:0]
+	for _, column := range args.Info.Columns {
+		if !strings.HasPrefix(column.Name, savedKeyAlias) {
+			columns = append(columns, column)
 		}
 	}
-	return nil
-}
+	args.Info.Columns = columns
 
-func WriteDataWithCount(c *gin.Context, pagStart, pagEnd string, data any, count int64) error {
-	c.Header("X-Total-Count", strconv.Itoa(int(count)))
-	var link string
-	if query.ShouldPaginate(pagStart, pagEnd) {
-		limit := query.GetLimit(pagStart, pagEnd)
-		start := query.GetOffset(pagStart) + limit
-		end := start + limit
-		if int64(end) < count {
-			var params []string
-			for key, values := range c.Request.URL.Query() {
-				switch key {
-				case "pagStart":
-					params = append(params, key+"="+strconv.Itoa(start))
-				case "pagEnd":
-					params = append(params, key+"="+strconv.Itoa(end))
-				default:
-					params = append(params, key+"="+strings.Join(values, "&"+key+"="))
-				}
-			}
-			link = c.FullPath() + "?" + strings.Join(params, "&")
-			c.Header("Link", link)
+	if val.Kind() != reflect.Slice {
+		if len(rows) == 0 {
+			c.JSON(http.StatusOK, model)
+			return nil
 		}
+		args.Result = rows
+		args.Count = 1
+		return Encode(c, Payload{Data: rows[0], Count: 1, Args: &args})
 	}
-	switch c.GetHeader("Accept") {
-	case "application/csv", "text/csv":
-		c.Header("Content-Type", c.GetHeader("Accept")+"; charset=utf-8")
-		c.Header("Content-Disposition", "attachment; filename=data.csv")
-		c.Status(http.StatusOK)
+	args.Primaries = nil
+	args.Result = rows
+	args.Count = int64(len(rows))
+	return Encode(c, Payload{Data: rows, Count: args.Count, Args: &args})
+}
 
-		var csvData [][]string
-		v := reflect.ValueOf(data).Elem()
-		t := v.Type()
-		if t.Kind() != reflect.Slice {
-			t = reflect.SliceOf(t)
-			v = reflect.Append(reflect.New(t).Elem(), v)
-		}
+// savedKeyAlias prefixes the aliases of the primary keys selected by WriteSaved
+const savedKeyAlias = "__savedKey"
 
-		l := v.Len()
-		if l > 0 {
+// WriteQueryMapResult writes the result of a query in the format requested by the Accept header, answering conditional requests
+func WriteQueryMapResult(c *gin.Context, args *query.QueryArgs) error {
+	return Conditional(c, args.Model, LastModified(args), func() error {
+		return writeQueryMapResult(c, args)
+	})
+}
 
-			t = t.Elem()
-			if t.Kind() == reflect.Ptr {
-				t = t.Elem()
-			}
+func writeQueryMapResult(c *gin.Context, args *query.QueryArgs) error {
+	if args.Count >= 0 {
+		c.Header("X-Total-Count", strconv.Itoa(int(args.Count)))
+	}
+	if args.EstimatedCount {
+		c.Header("X-Total-Count-Estimated", "1")
+	}
+	var links PageLinks
+	if query.ShouldUseCursor(args) {
+		links = CursorLinks(c, args)
+	} else if len(args.Primaries) == 0 {
+		links = OffsetLinks(c, args.PagStart, args.PagEnd, args.Count, len(args.Result))
+	}
+	links.Write(c)
+	var result any = args.Result
+	if len(args.Primaries) != 0 {
+		result = args.Result[0]
+		// TODO: It might be advisable to set Count to 1 in this situation
+	}
+	return Encode(c, Payload{Args: args, Data: result, Links: links, Count: args.Count, NextCursor: args.NextCursor, PrevCursor: args.PrevCursor})
+}
 
-			var row []string
-			for j := 0; j < t.NumField(); j++ {
-				row = append(row, t.Field(j).Name)
-			}
-			csvData = append(csvData, row)
+// WriteDataWithCount writes the data in the format requested by the Accept header, answering conditional requests
+func WriteDataWithCount(c *gin.Context, pagStart, pagEnd string, data any, count int64) error {
+	return Conditional(c, dataModel(data), time.Time{}, func() error {
+		return writeDataWithCount(c, pagStart, pagEnd, data, count)
+	})
+}
 
-			for i := 0; i < l; i++ {
-				item := v.Index(i).Elem()
-				ti := item.Type()
-				var row []string
-				for j := 0; j < ti.NumField(); j++ {
-					f := item.Field(j)
-					if f.IsValid() && !f.IsZero() {
-						if f.Type().Kind() == reflect.Ptr {
-							f = f.Elem()
-						}
-						if f.Type().Kind() == reflect.Slice || f.Type().Kind() == reflect.Array {
-							v, _ := json.Marshal(f.Interface())
-							row = append(row, string(v))
-						} else if marshaler, ok := f.Interface().(json.Marshaler); ok {
-							v, _ := marshaler.MarshalJSON()
-							row = append(row, strings.TrimSuffix(strings.TrimPrefix(string(v), "\""), "\""))
-						} else if stringer, ok := f.Interface().(fmt.Stringer); ok {
-							row = append(row, stringer.String())
-						} else {
-							row = append(row, fmt.Sprintf("%v", f.Interface()))
-						}
-					} else {
-						row = append(row, "")
-					}
-				}
-				csvData = append(csvData, row)
-			}
-		}
-		if err := csv.NewWriter(c.Writer).WriteAll(csvData); err != nil {
-			return err
-		}
-	case "application/xml", "text/xml":
-		if reflect.TypeOf(data).Name() == "" || len(c.Query("wrap")) > 0 {
-			c.XML(http.StatusOK, Response{Data: data, Next: link, Count: count})
-		} else {
-			c.XML(http.StatusOK, data)
-		}
-	default:
-		if len(c.Query("wrap")) > 0 {
-			c.JSON(http.StatusOK, Response{Data: data, Next: link, Count: count})
-		} else {
-			c.JSON(http.StatusOK, data)
-		}
-	}
-	return nil
+func writeDataWithCount(c *gin.Context, pagStart, pagEnd string, data any, count int64) error {
+	c.Header("X-Total-Count", strconv.Itoa(int(count)))
+	links := OffsetLinks(c, pagStart, pagEnd, count, 0)
+	links.Write(c)
+	return Encode(c, Payload{Data: data, Links: links, Count: count})
 }
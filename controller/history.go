@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"api_core/app/dialectors"
+	"api_core/audit"
+	"api_core/message"
+	"api_core/model"
+	"api_core/permissions"
+	"api_core/query"
+	"api_core/request"
+	"api_core/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// HistoryEntry is a change of a record in the history response, its changes are limited to the fields the caller can read
+type HistoryEntry struct {
+	Action    string          `json:"action"`
+	Changes   json.RawMessage `json:"changes"`
+	Subject   string          `json:"subject"`
+	RequestID string          `json:"requestId"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func ModelHistoryHandler(modelGetter func() any) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mdl := modelGetter()
+		db := request.DB(c)
+		modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			message.InternalServerError(c).Write(c)
+			return
+		}
+		err = GetPathParams(c, mdl, utils.GetPrimaryFields(modelSchema.ModelType), mdl)
+		if AbortIfError(c, err) {
+			return
+		}
+		// The history of a record out of the scope of the request is hidden as the record
+		if _, ok := mdl.(model.ConditionsModel); ok {
+			err = checkReadable(c, db, modelSchema, reflect.ValueOf(mdl))
+			if AbortIfError(c, err) {
+				return
+			}
+		}
+		pagStart, pagEnd := c.Query("pagStart"), c.Query("pagEnd")
+		entries, count, err := audit.History(db, modelSchema.Name, audit.Keys(modelSchema, reflect.ValueOf(mdl)), query.Paginate(pagStart, pagEnd))
+		if AbortIfError(c, err) {
+			return
+		}
+		history := make([]HistoryEntry, len(entries))
+		for i, entry := range entries {
+			changes, err := readableChanges(c, modelSchema, entry.CHANGES)
+			if AbortIfError(c, err) {
+				return
+			}
+			history[i] = HistoryEntry{
+				Action:    entry.ACTION,
+				Changes:   changes,
+				Subject:   entry.SUBJECT,
+				RequestID: entry.REQUEST_ID,
+				CreatedAt: entry.CREATED_AT,
+			}
+		}
+		err = WriteDataWithCount(c, pagStart, pagEnd, &history, count)
+		if AbortIfError(c, err) {
+			return
+		}
+	}
+}
+
+// checkReadable verifies that the record can be read like with a GET, failing with ItemNotFound when it's out of the scope of the request or doesn't exist
+func checkReadable(c *gin.Context, db *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value) error {
+	dialector, err := dialectors.ByDB(db)
+	if err != nil {
+		return err
+	}
+	primaries := map[string]interface{}{}
+	names := make([]string, len(modelSchema.PrimaryFields))
+	for i, field := range modelSchema.PrimaryFields {
+		primaries[field.DBName], _ = field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		names[i] = field.Name
+	}
+	args := query.QueryArgs{
+		Sel:       strings.Join(names, ","),
+		Primaries: primaries,
+		Model:     reflect.New(modelSchema.ModelType).Interface(),
+	}
+	return query.Query(c, db, &args, query.QueryConfig{Dialector: dialector})
+}
+
+// readableChanges removes from the changes of an audit entry the fields and the relations the caller can't read
+func readableChanges(c *gin.Context, modelSchema *schema.Schema, changes string) (json.RawMessage, error) {
+	d := audit.Diff{}
+	if err := json.Unmarshal([]byte(changes), &d); err != nil {
+		return nil, err
+	}
+	return json.Marshal(readableDiff(c, modelSchema, d))
+}
+
+func readableDiff(c *gin.Context, modelSchema *schema.Schema, d audit.Diff) audit.Diff {
+	readable := audit.Diff{}
+	for _, change := range d.Fields {
+		if field := modelSchema.LookUpField(change.Field); field != nil && permissions.CanRead(c, modelSchema, field) {
+			readable.Fields = append(readable.Fields, change)
+		}
+	}
+	for _, change := range d.Relations {
+		rel, ok := modelSchema.Relationships.Relations[change.Relation]
+		if !ok || !permissions.CanRead(c, modelSchema, rel.Field) || permissions.Get(reflect.New(rel.FieldSchema.ModelType).Interface())(c) != nil {
+			continue
+		}
+		change.Diff = readableDiff(c, rel.FieldSchema, change.Diff)
+		readable.Relations = append(readable.Relations, change)
+	}
+	return readable
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"api_core/audit"
+	"api_core/message"
+	"api_core/request"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyTTL is how long the responses are kept to be replayed
+var IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyLease is how long a key stays locked by a request in progress, after it the key is released as left by a crashed process
+var IdempotencyLease = time.Minute
+
+// IdempotencyWait is how long a retry waits for the request with the same key still in progress, before failing with 409
+var IdempotencyWait = 10 * time.Second
+
+type IdempotencyModel struct {
+	KEY          string `gorm:"primaryKey;size:64"`
+	REQUEST_HASH string `gorm:"size:64"`
+	// STATUS is 0 while the request is in progress
+	STATUS       int
+	CONTENT_TYPE string `gorm:"size:255"`
+	RESPONSE     string `gorm:"type:text"`
+	EXPIRES_AT   time.Time
+}
+
+func (IdempotencyModel) TableName() string {
+	return "IDEMPOTENCY_KEYS"
+}
+
+/*
+Idempotent makes the POST handler safe to retry when the client sends the Idempotency-Key header.
+The first request with a key locks it and its response is stored, the retries with the same body receive the stored response with the Idempotent-Replayed header.
+A key reused with a different request fails with 409, as a retry arriving while the first request is still running after IdempotencyWait.
+The lock of a request in progress expires after IdempotencyLease, the stored responses after IdempotencyTTL.
+Keys are scoped to the subject of the request, the 5xx responses are not stored so that the request can be retried.
+*/
+func Idempotent(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		// Dry runs are never stored, they don't change anything to retry
+		if key == "" || IsDryRun(c) {
+			handler(c)
+			return
+		}
+		body, err := c.GetRawData()
+		if err != nil {
+			message.BadRequest(c).Text(err.Error()).Write(c)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		keyHash := sha256.Sum256([]byte(audit.SubjectGetter(c) + "\n" + key))
+		requestHash := sha256.New()
+		requestHash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		requestHash.Write(body)
+		record := IdempotencyModel{
+			KEY:          hex.EncodeToString(keyHash[:]),
+			REQUEST_HASH: hex.EncodeToString(requestHash.Sum(nil)),
+			EXPIRES_AT:   time.Now().Add(IdempotencyLease),
+		}
+
+		db := request.DB(c).Session(&gorm.Session{NewDB: true})
+		for {
+			locked, err := lockIdempotencyKey(db, &record)
+			if AbortIfError(c, err) {
+				return
+			}
+			if locked {
+				break
+			}
+			if replayIdempotent(c, db, record) {
+				return
+			}
+		}
+
+		stored := false
+		writer := c.Writer
+		buffer := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+		defer func() {
+			// On panic the writer is restored for the recovery to write its response, and the key is released as the response can't be replayed
+			c.Writer = writer
+			if !stored {
+				db.Delete(&IdempotencyModel{KEY: record.KEY})
+			}
+		}()
+
+		c.Writer = buffer
+		handler(c)
+		c.Writer = writer
+
+		if buffer.status < http.StatusInternalServerError {
+			err := db.Model(&IdempotencyModel{KEY: record.KEY}).Updates(IdempotencyModel{
+				STATUS:       buffer.status,
+				CONTENT_TYPE: writer.Header().Get("Content-Type"),
+				RESPONSE:     buffer.body.String(),
+				EXPIRES_AT:   time.Now().Add(IdempotencyTTL),
+			}).Error
+			stored = err == nil
+		}
+		c.Writer.WriteHeader(buffer.status)
+		c.Writer.Write(buffer.body.Bytes())
+	}
+}
+
+// lockIdempotencyKey inserts the record of the key, it returns false when the key already exists
+func lockIdempotencyKey(db *gorm.DB, record *IdempotencyModel) (bool, error) {
+	if err := db.Where(clause.Lt{Column: clause.Column{Name: db.NamingStrategy.ColumnName("", "EXPIRES_AT")}, Value: time.Now()}).Delete(&IdempotencyModel{}).Error; err != nil {
+		return false, err
+	}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+/*
+replayIdempotent writes the stored response of the key, waiting for the request holding it to complete.
+It returns false without writing when the key has been released by a failed request or its lease has expired, so that it can be locked again.
+*/
+func replayIdempotent(c *gin.Context, db *gorm.DB, record IdempotencyModel) bool {
+	deadline := time.Now().Add(IdempotencyWait)
+	for {
+		stored := IdempotencyModel{}
+		res := db.Where(&IdempotencyModel{KEY: record.KEY}).Limit(1).Find(&stored)
+		if AbortIfError(c, res.Error) {
+			return true
+		}
+		// The lease of a lock left by a crashed process has expired, it's deleted when locking again
+		if res.RowsAffected == 0 || (stored.STATUS == 0 && stored.EXPIRES_AT.Before(time.Now())) {
+			return false
+		}
+		if stored.REQUEST_HASH != record.REQUEST_HASH {
+			message.IdempotencyKeyReused(c).Write(c)
+			return true
+		}
+		if stored.STATUS != 0 {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.STATUS, stored.CONTENT_TYPE, []byte(stored.RESPONSE))
+			return true
+		}
+		if time.Now().After(deadline) {
+			message.IdempotencyKeyInProgress(c).Write(c)
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
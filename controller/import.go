@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api_core/audit"
+	"api_core/message"
+	"api_core/permissions"
+	"api_core/request"
+	"api_core/xlsx"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	ImportInsert = "insert"
+	ImportUpdate = "update"
+)
+
+type ImportRow struct {
+	Row    int      `json:"row"`
+	Action string   `json:"action,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun   bool        `json:"dryRun"`
+	Inserted int         `json:"inserted"`
+	Updated  int         `json:"updated"`
+	Failed   int         `json:"failed"`
+	Rows     []ImportRow `json:"rows"`
+}
+
+// errRollback discards the changes made in a transaction without reporting an error
+var errRollback = errors.New("rollback")
+
+var importTimeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "02/01/2006 15:04:05", "02/01/2006 15:04", "02/01/2006"}
+
+/*
+ModelImportHandler imports the rows of a CSV or XLSX file, sent as the "file" form field or as the body of the request.
+The columns are mapped to the fields by name or label; the rows whose update keys, the fields tagged with import:"updateKey", match an existing record update it, the others are inserted.
+The import is executed in a single transaction and nothing is saved if a row fails, as a dry run it's always rolled back.
+*/
+func ModelImportHandler(modelGetter func() any) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mdl := modelGetter()
+		db := request.DB(c)
+		modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			message.InternalServerError(c).Write(c)
+			return
+		}
+
+		rows, decimalMark, err := readImportRows(c)
+		if AbortIfError(c, err) {
+			return
+		}
+		if len(rows) < 2 {
+			message.Unprocessable(c).Write(c)
+			return
+		}
+
+		columns := make([]*schema.Field, len(rows[0]))
+		for i, heading := range rows[0] {
+			heading = strings.TrimSpace(heading)
+			if heading == "" {
+				continue
+			}
+			columns[i] = importField(modelSchema, heading)
+			if columns[i] == nil {
+				message.InvalidField(c, heading).Write(c)
+				return
+			}
+			if !columns[i].PrimaryKey && !permissions.CanWrite(c, modelSchema, columns[i]) {
+				message.ReadOnlyFields(c, heading).Write(c)
+				return
+			}
+		}
+
+		keyFields := []*schema.Field{}
+		for _, field := range modelSchema.Fields {
+			if strings.Contains(field.Tag.Get("import"), "updateKey") {
+				keyFields = append(keyFields, field)
+			}
+		}
+		if len(keyFields) == 0 {
+			keyFields = modelSchema.PrimaryFields
+		}
+
+		report := ImportReport{DryRun: IsDryRun(c), Rows: []ImportRow{}}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i, cells := range rows[1:] {
+				row := ImportRow{Row: i + 2}
+				if isEmptyRow(cells) {
+					continue
+				}
+				row.Action, row.Errors = importRow(c, tx, modelSchema, columns, keyFields, cells, decimalMark)
+				if len(row.Errors) > 0 {
+					report.Failed++
+				} else if row.Action == ImportInsert {
+					report.Inserted++
+				} else {
+					report.Updated++
+				}
+				report.Rows = append(report.Rows, row)
+			}
+			if report.DryRun || report.Failed > 0 {
+				return errRollback
+			}
+			return nil
+		})
+		if err != nil && err != errRollback {
+			AbortWithError(c, err)
+			return
+		}
+		if report.Failed > 0 {
+			c.JSON(http.StatusUnprocessableEntity, report)
+		} else {
+			c.JSON(http.StatusOK, report)
+		}
+	}
+}
+
+// importRow saves a single row inside a savepoint, so that the other rows can still be checked if it fails
+func importRow(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, columns []*schema.Field, keyFields []*schema.Field, cells []string, decimalMark string) (string, []string) {
+	modelVal := reflect.New(modelSchema.ModelType)
+	values := map[string]interface{}{}
+	errs := []string{}
+	for i, field := range columns {
+		if field == nil || i >= len(cells) || strings.TrimSpace(cells[i]) == "" {
+			continue
+		}
+		value, err := importValue(field, strings.TrimSpace(cells[i]), decimalMark)
+		if err == nil {
+			err = field.Set(context.Background(), modelVal.Elem(), value)
+		}
+		if err != nil {
+			errs = append(errs, message.InvalidParamType(c, field.Name, strings.ReplaceAll(field.FieldType.String(), "*", "")).Error())
+			continue
+		}
+		values[field.Name], _ = field.ValueOf(context.Background(), modelVal.Elem())
+	}
+	// A row without the update keys would be matched with IS NULL, the update keys are required while the primary keys are left empty to insert
+	keys := []clause.Expression{}
+	for _, field := range keyFields {
+		val, zero := field.ValueOf(context.Background(), modelVal.Elem())
+		if !zero {
+			keys = append(keys, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+		} else if strings.Contains(field.Tag.Get("import"), "updateKey") {
+			errs = append(errs, message.RuleText(c, FieldLabel(field), "required", ""))
+		}
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	action := ImportInsert
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		existing := reflect.New(modelSchema.ModelType)
+		found := false
+		if len(keys) > 0 && len(keys) == len(keyFields) {
+			// The key is looked up out of the scope too, a record out of scope is reported instead of being duplicated
+			res := tx.Session(&gorm.Session{NewDB: true}).Model(existing.Interface()).Where(clause.And(keys...)).Limit(1).Find(existing.Interface())
+			if res.Error != nil {
+				return res.Error
+			}
+			found = res.RowsAffected > 0
+		}
+
+		if found {
+			action = ImportUpdate
+			if err := CheckScope(c, tx, modelSchema, existing); err != nil {
+				return err
+			}
+			if err := permissions.Patch(modelVal.Interface())(c); err != nil {
+				return err
+			}
+			// The record resulting from the update is validated
+			for name, val := range values {
+				if err := modelSchema.LookUpField(name).Set(context.Background(), existing.Elem(), val); err != nil {
+					return err
+				}
+			}
+			if err := ValidateStruct(c, existing.Interface()); err != nil {
+				return err
+			}
+			for _, field := range modelSchema.PrimaryFields {
+				val, _ := field.ValueOf(context.Background(), existing.Elem())
+				if err := field.Set(context.Background(), modelVal.Elem(), val); err != nil {
+					return err
+				}
+				delete(values, field.Name)
+			}
+			snapshot, err := audit.Take(tx, modelSchema, modelVal)
+			if err != nil {
+				return err
+			}
+			IncrementVersion(modelSchema, values)
+			if err := WithScope(tx.Model(modelVal.Interface()), modelSchema).Updates(values).Error; err != nil {
+				return err
+			}
+			return audit.Record(c, tx, modelSchema, audit.Update, modelVal, snapshot)
+		}
+
+		if err := ValidateStruct(c, modelVal.Interface()); err != nil {
+			return err
+		}
+		if err := tx.Create(modelVal.Interface()).Error; err != nil {
+			return err
+		}
+		return audit.Record(c, tx, modelSchema, audit.Create, modelVal, nil)
+	})
+	if validationErrs := message.ValidationErrorsOf(err); len(validationErrs) > 0 {
+		texts := make([]string, len(validationErrs))
+		for i, e := range validationErrs {
+			texts[i] = e.Message
+		}
+		return action, texts
+	}
+	if err != nil {
+		return action, []string{err.Error()}
+	}
+	return action, nil
+}
+
+// importField finds the field corresponding to the heading of a column, by name, column name or label
+func importField(modelSchema *schema.Schema, heading string) *schema.Field {
+	if field := modelSchema.LookUpField(heading); field != nil && field.DBName != "" {
+		return field
+	}
+	for _, field := range modelSchema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if strings.EqualFold(heading, field.Name) || strings.EqualFold(heading, FieldLabel(field)) {
+			return field
+		}
+	}
+	return nil
+}
+
+// importValue converts the text of a cell to a value assignable to the field, the numbers are written with the decimal mark
+func importValue(field *schema.Field, text, decimalMark string) (any, error) {
+	typ := field.IndirectFieldType
+	if typ.ConvertibleTo(reflect.TypeOf(time.Time{})) {
+		for _, format := range importTimeFormats {
+			if t, err := time.ParseInLocation(format, text, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return xlsx.ParseSerial(text)
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		switch strings.ToLower(text) {
+		case "1", "true", "si", "sì", "yes", "x":
+			return true, nil
+		case "0", "false", "no":
+			return false, nil
+		}
+		return strconv.ParseBool(text)
+	case reflect.Float32, reflect.Float64:
+		return parseNumber(text, decimalMark)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := parseNumber(text, decimalMark)
+		if err != nil || number != math.Trunc(number) {
+			return strconv.ParseInt(text, 10, 64)
+		}
+		return int64(number), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, err := parseNumber(text, decimalMark)
+		if err != nil || number < 0 || number != math.Trunc(number) {
+			return strconv.ParseUint(text, 10, 64)
+		}
+		return uint64(number), nil
+	}
+	return text, nil
+}
+
+/*
+parseNumber parses a number written with the decimal mark and optionally grouped by thousands with the other mark, e.g. 1.234,5 with the comma.
+Numbers whose groups aren't of three digits, like the ones written by programs with the dot, are parsed as plain numbers.
+*/
+func parseNumber(text, decimalMark string) (float64, error) {
+	separator := ","
+	if decimalMark == "," {
+		separator = "."
+	}
+	integer, decimals, hasDecimals := strings.Cut(text, decimalMark)
+	groups := strings.Split(integer, separator)
+	valid := !strings.Contains(decimals, separator)
+	if first := strings.TrimLeft(groups[0], "+-"); len(groups) > 1 && (first == "" || len(first) > 3) {
+		valid = false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			valid = false
+		}
+	}
+	if !valid {
+		return strconv.ParseFloat(text, 64)
+	}
+	number := strings.Join(groups, "")
+	if hasDecimals {
+		number += "." + decimals
+	}
+	return strconv.ParseFloat(number, 64)
+}
+
+// readImportRows returns the cells of the file, along with the decimal mark of its numbers
+func readImportRows(c *gin.Context) ([][]string, string, error) {
+	var data []byte
+	var name string
+	if file, err := c.FormFile("file"); err == nil {
+		name = file.Filename
+		f, err := file.Open()
+		if err != nil {
+			return nil, "", message.BadRequest(c).Text(err.Error())
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, "", message.BadRequest(c).Text(err.Error())
+		}
+	} else {
+		if data, err = c.GetRawData(); err != nil {
+			return nil, "", message.BadRequest(c).Text(err.Error())
+		}
+	}
+	if len(data) == 0 {
+		return nil, "", message.Unprocessable(c)
+	}
+
+	if strings.EqualFold(filepath.Ext(name), ".xlsx") || c.ContentType() == XLSXContentType {
+		rows, err := xlsx.ReadRows(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, "", message.Unprocessable(c).Text(err.Error())
+		}
+		// The numbers are stored with the dot, the ones in text cells are parsed as plain numbers too
+		return rows, ".", nil
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = importSeparator(c, data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, "", message.Unprocessable(c).Text(err.Error())
+	}
+	return rows, GetCSVOptions(c).DecimalMark, nil
+}
+
+// importSeparator returns the separator specified with the sep param, or the most frequent one in the heading
+func importSeparator(c *gin.Context, data []byte) rune {
+	if sep := c.Query("sep"); sep != "" {
+		if sep == "\\t" {
+			return '\t'
+		}
+		return []rune(sep)[0]
+	}
+	heading := string(data)
+	if index := strings.IndexAny(heading, "\r\n"); index != -1 {
+		heading = heading[:index]
+	}
+	separator, max := ',', 0
+	for _, sep := range []rune{',', ';', '\t', '|'} {
+		if n := strings.Count(heading, string(sep)); n > max {
+			separator, max = sep, n
+		}
+	}
+	return separator
+}
+
+func isEmptyRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
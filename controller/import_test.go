@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text, decimalMark string
+		want              float64
+		wantErr           bool
+	}{
+		{"1234", ",", 1234, false},
+		{"1234,5", ",", 1234.5, false},
+		{"1.234,5", ",", 1234.5, false},
+		{"-1.234.567,25", ",", -1234567.25, false},
+		{"1,234.5", ".", 1234.5, false},
+		{"1234.5", ".", 1234.5, false},
+		// Groups that aren't of three digits are read as plain numbers, like the ones written with the dot
+		{"1234.5", ",", 1234.5, false},
+		{"0.5", ",", 0.5, false},
+		{"1.23,4", ",", 0, true},
+		{"1.234,5.6", ",", 0, true},
+		{"abc", ",", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseNumber(tt.text, tt.decimalMark)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNumber(%q, %q) error = %v, wantErr %v", tt.text, tt.decimalMark, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseNumber(%q, %q) = %v, want %v", tt.text, tt.decimalMark, got, tt.want)
+		}
+	}
+}
+
+func TestImportSeparator(t *testing.T) {
+	tests := []struct {
+		query, data string
+		want        rune
+	}{
+		{"", "ID,NAME,CODE\n1;2;3;4", ','},
+		{"", "ID;NAME;CODE\r\n1,2,3,4", ';'},
+		{"", "ID\tNAME\tCODE", '\t'},
+		{"", "ID|NAME", '|'},
+		{"", "ID", ','},
+		{"?sep=%3B", "ID,NAME", ';'},
+		{`?sep=\t`, "ID,NAME", '\t'},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/import"+tt.query, nil)
+		if got := importSeparator(c, []byte(tt.data)); got != tt.want {
+			t.Errorf("importSeparator(%q, %q) = %q, want %q", tt.query, tt.data, got, tt.want)
+		}
+	}
+}
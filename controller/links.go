@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PublicURL is the scheme and host of the links written in the responses, e.g. https://api.example.com, when empty they are taken from the request
+var PublicURL string
+
+// TrustedProxies are the addresses of the proxies, single IPs or CIDR networks, whose X-Forwarded-Proto and X-Forwarded-Host headers are honoured
+var TrustedProxies []string
+
+// PageLinks are the absolute URLs of the pages of a list, empty when the page doesn't exist or can't be determined
+type PageLinks struct {
+	First string
+	Prev  string
+	Next  string
+	Last  string
+}
+
+// Header returns the value of the Link header as defined by RFC 8288, empty without links
+func (l PageLinks) Header() string {
+	links := []string{}
+	for _, link := range []struct{ rel, url string }{{"first", l.First}, {"prev", l.Prev}, {"next", l.Next}, {"last", l.Last}} {
+		if link.url != "" {
+			links = append(links, "<"+link.url+`>; rel="`+link.rel+`"`)
+		}
+	}
+	return strings.Join(links, ", ")
+}
+
+// Write sets the Link header of the response
+func (l PageLinks) Write(c *gin.Context) {
+	if header := l.Header(); header != "" {
+		c.Header("Link", header)
+	}
+}
+
+/*
+OffsetLinks returns the links of a list paginated with pagStart and pagEnd.
+Count is the total of the rows, when it's negative the last page is unknown and the next one is assumed to exist if the current page, of size rows, is full.
+*/
+func OffsetLinks(c *gin.Context, pagStart, pagEnd string, count int64, size int) PageLinks {
+	links := PageLinks{}
+	if !query.ShouldPaginate(pagStart, pagEnd) {
+		return links
+	}
+	offset := query.GetOffset(pagStart)
+	limit := query.GetLimit(pagStart, pagEnd)
+	if limit <= 0 {
+		return links
+	}
+	page := func(start int) string {
+		return RequestURL(c, map[string]string{"pagStart": strconv.Itoa(start), "pagEnd": strconv.Itoa(start + limit)})
+	}
+
+	links.First = page(0)
+	if offset > 0 {
+		start := max(offset-limit, 0)
+		links.Prev = RequestURL(c, map[string]string{"pagStart": strconv.Itoa(start), "pagEnd": strconv.Itoa(offset)})
+	}
+	if count >= 0 {
+		if int64(offset+limit) < count {
+			links.Next = page(offset + limit)
+		}
+		// The last page starts at the last multiple of the limit from the current offset
+		last := int64(offset)
+		if count > last {
+			last += (count - 1 - last) / int64(limit) * int64(limit)
+		} else {
+			last = max(count-1, 0) / int64(limit) * int64(limit)
+		}
+		links.Last = page(int(last))
+	} else if size >= limit {
+		links.Next = page(offset + limit)
+	}
+	return links
+}
+
+// CursorLinks returns the links of a list paginated with cursors, the first page is requested without cursor
+func CursorLinks(c *gin.Context, args *query.QueryArgs) PageLinks {
+	links := PageLinks{First: RequestURL(c, map[string]string{"cursor": ""})}
+	if args.PrevCursor != "" {
+		links.Prev = RequestURL(c, map[string]string{"cursor": args.PrevCursor})
+	}
+	if args.NextCursor != "" {
+		links.Next = RequestURL(c, map[string]string{"cursor": args.NextCursor})
+	}
+	return links
+}
+
+/*
+RequestURL returns the absolute URL of the request with the params replaced, the params with an empty value are removed.
+The scheme and the host are the ones of PublicURL when set, otherwise the ones of the request.
+Behind one of the TrustedProxies they are taken from the X-Forwarded-Proto and X-Forwarded-Host headers, which can't be trusted from the clients.
+*/
+func RequestURL(c *gin.Context, params map[string]string) string {
+	u := url.URL{Scheme: "http", Host: c.Request.Host, Path: c.Request.URL.Path}
+	if c.Request.TLS != nil {
+		u.Scheme = "https"
+	}
+	if public, err := url.Parse(PublicURL); PublicURL != "" && err == nil {
+		u.Scheme, u.Host = public.Scheme, public.Host
+	} else if isTrustedProxy(c.RemoteIP()) {
+		if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+			u.Scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+		}
+		if host := c.GetHeader("X-Forwarded-Host"); host != "" {
+			u.Host = strings.TrimSpace(strings.Split(host, ",")[0])
+		}
+	}
+
+	values := c.Request.URL.Query()
+	for key, val := range params {
+		if val == "" {
+			values.Del(key)
+		} else {
+			values.Set(key, val)
+		}
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+func isTrustedProxy(remoteIP string) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(proxy)) {
+			return true
+		}
+	}
+	return false
+}
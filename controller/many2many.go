@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"api_core/message"
+	"api_core/permissions"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Many2ManyNames returns the many2many relations of the schema, which are omitted from the saves of GORM and written by SaveMany2Many.
+The ones of the nested has one and has many relations are included as paths, like Rows.Tags.
+*/
+func Many2ManyNames(modelSchema *schema.Schema) []string {
+	return many2ManyPaths(modelSchema, "", map[*schema.Schema]struct{}{})
+}
+
+func many2ManyPaths(modelSchema *schema.Schema, prefix string, visiting map[*schema.Schema]struct{}) []string {
+	if _, ok := visiting[modelSchema]; ok {
+		return nil
+	}
+	visiting[modelSchema] = struct{}{}
+	defer delete(visiting, modelSchema)
+
+	names := []string{}
+	for _, rel := range modelSchema.Relationships.Many2Many {
+		names = append(names, prefix+rel.Name)
+	}
+	for _, rel := range append(append([]*schema.Relationship{}, modelSchema.Relationships.HasOne...), modelSchema.Relationships.HasMany...) {
+		if rel.Field.Updatable {
+			names = append(names, many2ManyPaths(rel.FieldSchema, prefix+rel.Name+".", visiting)...)
+		}
+	}
+	return names
+}
+
+// omitMany2Many excludes the many2many relations from the save of the record
+func omitMany2Many(tx *gorm.DB, modelSchema *schema.Schema) *gorm.DB {
+	if names := Many2ManyNames(modelSchema); len(names) > 0 {
+		return tx.Omit(names...)
+	}
+	return tx
+}
+
+/*
+SaveMany2Many writes the links of the many2many relations sent with the record and with its nested has one and has many records, which have to be already saved.
+The related records are linked by key, the ones with $delete are unlinked. With the replace param, listing the relations separated by commas, the links not sent are removed, the nested relations are listed by path like Rows.Tags.
+Related records without key are created only when the relation has the m2m:"create" tag, the links never update the related records.
+*/
+func SaveMany2Many(c *gin.Context, tx *gorm.DB, modelVal reflect.Value, modelSchema *schema.Schema) error {
+	replace := map[string]struct{}{}
+	for _, name := range strings.Split(c.Query("replace"), ",") {
+		replace[strings.TrimSpace(name)] = struct{}{}
+	}
+	return saveMany2Many(c, tx, modelVal, modelSchema, "", replace)
+}
+
+func saveMany2Many(c *gin.Context, tx *gorm.DB, modelVal reflect.Value, modelSchema *schema.Schema, prefix string, replace map[string]struct{}) error {
+	record := reflect.Indirect(modelVal)
+	if !record.IsValid() {
+		return nil
+	}
+	for _, rel := range append(append([]*schema.Relationship{}, modelSchema.Relationships.HasOne...), modelSchema.Relationships.HasMany...) {
+		if !rel.Field.Updatable {
+			continue
+		}
+		value := reflect.Indirect(record.FieldByName(rel.Field.Name))
+		items := []reflect.Value{value}
+		if value.Kind() == reflect.Slice {
+			items = make([]reflect.Value, value.Len())
+			for i := range items {
+				items[i] = value.Index(i)
+			}
+		}
+		for _, item := range items {
+			item = reflect.Indirect(item)
+			if !item.IsValid() || item.IsZero() {
+				continue
+			}
+			// The deleted records have no links to save
+			if deleteField := item.FieldByName("Delete"); deleteField.IsValid() && deleteField.Bool() {
+				continue
+			}
+			if err := saveMany2Many(c, tx, item, rel.FieldSchema, prefix+rel.Name+".", replace); err != nil {
+				return err
+			}
+		}
+	}
+	for _, rel := range modelSchema.Relationships.Many2Many {
+		if !rel.Field.Updatable {
+			continue
+		}
+		slice := reflect.Indirect(record.FieldByName(rel.Field.Name))
+		if slice.Kind() != reflect.Slice || slice.IsNil() {
+			continue
+		}
+
+		parent := []clause.Expression{}
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				val, _ := ref.PrimaryKey.ValueOf(context.Background(), record)
+				parent = append(parent, clause.Eq{Column: clause.Column{Table: rel.JoinTable.Table, Name: ref.ForeignKey.DBName}, Value: val})
+			}
+		}
+		joinTx := func() *gorm.DB {
+			return tx.Session(&gorm.Session{NewDB: true}).Table(rel.JoinTable.Table)
+		}
+
+		linked := []clause.Expression{}
+		for i := slice.Len() - 1; i >= 0; i-- {
+			item := slice.Index(i)
+			itemVal := item
+			if item.Kind() == reflect.Ptr {
+				item = item.Elem()
+			} else {
+				itemVal = item.Addr()
+			}
+
+			deleteField := item.FieldByName("Delete")
+			unlink := deleteField.IsValid() && deleteField.Bool()
+			if !unlink {
+				if err := linkedRecord(c, tx, rel, itemVal); err != nil {
+					return err
+				}
+			}
+			keys := map[string]any{}
+			conds := append([]clause.Expression{}, parent...)
+			for _, ref := range rel.References {
+				if !ref.OwnPrimaryKey {
+					val, _ := ref.PrimaryKey.ValueOf(context.Background(), item)
+					keys[ref.ForeignKey.DBName] = val
+					conds = append(conds, clause.Eq{Column: clause.Column{Table: rel.JoinTable.Table, Name: ref.ForeignKey.DBName}, Value: val})
+				}
+			}
+
+			if unlink {
+				if err := joinTx().Where(clause.And(conds...)).Delete(reflect.New(rel.JoinTable.ModelType).Interface()).Error; err != nil {
+					return err
+				}
+				slice.Index(i).Set(slice.Index(slice.Len() - 1))
+				slice.Set(slice.Slice(0, slice.Len()-1))
+				continue
+			}
+
+			var count int64
+			if err := joinTx().Where(clause.And(conds...)).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				row := map[string]any{}
+				for _, ref := range rel.References {
+					if ref.OwnPrimaryKey {
+						row[ref.ForeignKey.DBName], _ = ref.PrimaryKey.ValueOf(context.Background(), record)
+					}
+				}
+				for name, val := range keys {
+					row[name] = val
+				}
+				if err := joinTx().Create(row).Error; err != nil {
+					return err
+				}
+			}
+			linked = append(linked, clause.And(conds[len(parent):]...))
+		}
+
+		if _, ok := replace[prefix+rel.Name]; ok {
+			del := joinTx().Where(clause.And(parent...))
+			if len(linked) > 0 {
+				del = del.Where(clause.Not(clause.Or(linked...)))
+			}
+			if err := del.Delete(reflect.New(rel.JoinTable.ModelType).Interface()).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// linkedRecord creates the related record without key, if allowed by the relation and by the permissions of its model
+func linkedRecord(c *gin.Context, tx *gorm.DB, rel *schema.Relationship, itemVal reflect.Value) error {
+	for _, field := range rel.FieldSchema.PrimaryFields {
+		if _, zero := field.ValueOf(context.Background(), itemVal.Elem()); !zero {
+			return nil
+		}
+	}
+	if !strings.Contains(rel.Field.Tag.Get("m2m"), "create") {
+		return message.Many2ManyCreateNotAllowed(c, rel.Name)
+	}
+	if err := permissions.Post(itemVal.Interface())(c); err != nil {
+		return err
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(itemVal.Interface()).Error
+}
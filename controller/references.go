@@ -0,0 +1,368 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"api_core/app/dialectors"
+	"api_core/audit"
+	"api_core/message"
+	"api_core/permissions"
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	OnDeleteRestrict = ""
+	OnDeleteCascade  = "cascade"
+	OnDeleteSetNull  = "setNull"
+)
+
+// maxBlockingRecords is the number of records listed for every relation blocking a delete
+const maxBlockingRecords = 10
+
+var referenceSchemas sync.Map
+
+// referencesByTable caches the references of the models by table, it's cleared by RegisterModels
+var referencesByTable sync.Map
+
+// Reference is a relation through which the records of Schema point to the records of another model
+type Reference struct {
+	Label  string
+	Schema *schema.Schema
+	// ForeignKeys are the fields of Schema holding the values of the fields References of the referenced model
+	ForeignKeys []*schema.Field
+	References  []*schema.Field
+	// OnDelete is what happens to the records of Schema when the referenced record is deleted, OnDeleteRestrict blocks the delete
+	OnDelete string
+	// Join reports that Schema is the join table of a many2many relation, whose rows are links
+	Join bool
+}
+
+/*
+References returns the relations pointing to the model, derived from the schemas of the models registered in ModelByName.
+The relations are declared either as has one or has many on the model or as belongs to on the referencing model.
+By default the references block the delete of the record, a relation opts in to delete or detach the referencing records with the delete:"cascade" or delete:"setNull" tag, or with the OnDelete of its GORM constraint.
+The links of many2many relations are always removed with the record.
+*/
+func References(db *gorm.DB, modelSchema *schema.Schema) ([]Reference, error) {
+	if refs, ok := referencesByTable.Load(modelSchema.Table); ok {
+		return refs.([]Reference), nil
+	}
+	refs, err := findReferences(db, modelSchema)
+	if err != nil {
+		return nil, err
+	}
+	referencesByTable.Store(modelSchema.Table, refs)
+	return refs, nil
+}
+
+func findReferences(db *gorm.DB, modelSchema *schema.Schema) ([]Reference, error) {
+	names := make([]string, 0, len(ModelByName))
+	for name := range ModelByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	refs := []Reference{}
+	indexes := map[string]int{}
+	add := func(ref Reference) {
+		if len(ref.ForeignKeys) == 0 || strings.HasPrefix(ref.Schema.Table, "(") {
+			return
+		}
+		key := ref.Schema.Table
+		for _, field := range ref.ForeignKeys {
+			key += "." + field.DBName
+		}
+		if i, ok := indexes[key]; ok {
+			if refs[i].OnDelete == OnDeleteRestrict {
+				refs[i].OnDelete = ref.OnDelete
+			}
+			return
+		}
+		indexes[key] = len(refs)
+		refs = append(refs, ref)
+	}
+
+	for _, rel := range append(append([]*schema.Relationship{}, modelSchema.Relationships.HasOne...), modelSchema.Relationships.HasMany...) {
+		add(relationReference(FieldLabel(rel.Field), rel, rel.FieldSchema, modelSchema))
+	}
+	for _, name := range names {
+		relSchema, err := schema.Parse(ModelByName[name], &referenceSchemas, db.NamingStrategy)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range relSchema.Relationships.BelongsTo {
+			if rel.FieldSchema.Table == modelSchema.Table {
+				add(relationReference(name, rel, relSchema, modelSchema))
+			}
+		}
+		for _, rel := range relSchema.Relationships.Many2Many {
+			if relSchema.Table == modelSchema.Table || rel.FieldSchema.Table == modelSchema.Table {
+				ref := relationReference("", rel, rel.JoinTable, modelSchema)
+				ref.OnDelete = OnDeleteCascade
+				ref.Join = true
+				add(ref)
+			}
+		}
+	}
+	return refs, nil
+}
+
+// relationReference describes the relation as a reference from the records of relSchema to the ones of modelSchema
+func relationReference(label string, rel *schema.Relationship, relSchema, modelSchema *schema.Schema) Reference {
+	ref := Reference{Label: label, Schema: relSchema}
+	if rel.Polymorphic != nil {
+		return ref
+	}
+	for _, r := range rel.References {
+		if r.ForeignKey.Schema == relSchema && r.PrimaryKey.Schema.Table == modelSchema.Table {
+			ref.ForeignKeys = append(ref.ForeignKeys, r.ForeignKey)
+			ref.References = append(ref.References, r.PrimaryKey)
+		}
+	}
+	switch {
+	case rel.Field.Tag.Get("delete") == OnDeleteCascade:
+		ref.OnDelete = OnDeleteCascade
+	case rel.Field.Tag.Get("delete") == OnDeleteSetNull:
+		ref.OnDelete = OnDeleteSetNull
+	default:
+		switch strings.ToUpper(schema.ParseTagSetting(rel.Field.TagSettings["CONSTRAINT"], ",")["ONDELETE"]) {
+		case "CASCADE":
+			ref.OnDelete = OnDeleteCascade
+		case "SET NULL":
+			ref.OnDelete = OnDeleteSetNull
+		}
+	}
+	return ref
+}
+
+/*
+DeleteReferences prepares the delete of the record, which has to be loaded with the referenced fields.
+It fails with DeleteFailed listing the records that reference it, also through the cascades, by their DISPLAY_NAME or keys.
+Otherwise it deletes the referencing records with cascade and detaches the ones with setNull, so that the record can be deleted in the same transaction.
+*/
+func DeleteReferences(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value) error {
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	refs, err := References(tx, modelSchema)
+	if err != nil {
+		return err
+	}
+	missing := map[string]struct{}{}
+	for _, ref := range refs {
+		for _, field := range ref.References {
+			if _, zero := field.ValueOf(context.Background(), reflect.Indirect(modelVal)); zero {
+				missing[field.DBName] = struct{}{}
+			}
+		}
+	}
+	if len(missing) > 0 {
+		columns := make([]string, 0, len(missing))
+		for name := range missing {
+			columns = append(columns, name)
+		}
+		if err := tx.Select(columns).Find(modelVal.Interface()).Error; err != nil {
+			return err
+		}
+	}
+
+	blocking, err := blockingReferences(c, tx, modelSchema, modelVal, map[string]struct{}{})
+	if err != nil {
+		return err
+	}
+	if len(blocking) > 0 {
+		return message.DeleteFailed(c, blocking)
+	}
+	return deleteReferences(c, tx, modelSchema, modelVal, map[string]struct{}{})
+}
+
+// visitReference marks the record as visited by the cascade, it returns false when it already was, as the cascades can form cycles
+func visitReference(visited map[string]struct{}, modelSchema *schema.Schema, modelVal reflect.Value) bool {
+	key := modelSchema.Table + " " + audit.Keys(modelSchema, reflect.Indirect(modelVal))
+	if _, ok := visited[key]; ok {
+		return false
+	}
+	visited[key] = struct{}{}
+	return true
+}
+
+// referenceConditions filters the records of the reference pointing to the record, it returns false when the record has no value to point to
+func referenceConditions(ref Reference, modelVal reflect.Value) ([]clause.Expression, bool) {
+	conds := []clause.Expression{}
+	for i, field := range ref.References {
+		val, zero := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		if zero {
+			return nil, false
+		}
+		conds = append(conds, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: ref.ForeignKeys[i].DBName}, Value: val})
+	}
+	return conds, true
+}
+
+// referencingRecords loads the records of the reference pointing to the record, tx is a new session which can carry other conditions
+func referencingRecords(tx *gorm.DB, ref Reference, conds []clause.Expression) (reflect.Value, error) {
+	records := reflect.New(reflect.SliceOf(ref.Schema.ModelType))
+	err := tx.Where(clause.And(conds...)).Find(records.Interface()).Error
+	return records.Elem(), err
+}
+
+func blockingReferences(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value, visited map[string]struct{}) ([]string, error) {
+	if !visitReference(visited, modelSchema, modelVal) {
+		return nil, nil
+	}
+	refs, err := References(tx, modelSchema)
+	if err != nil {
+		return nil, err
+	}
+	blocking := []string{}
+	for _, ref := range refs {
+		conds, ok := referenceConditions(ref, modelVal)
+		if !ok || ref.Join || ref.OnDelete == OnDeleteSetNull {
+			continue
+		}
+		if ref.OnDelete == OnDeleteCascade {
+			records, err := referencingRecords(tx.Session(&gorm.Session{NewDB: true}), ref, conds)
+			if err != nil {
+				return nil, err
+			}
+			// The records out of the scope of the request can't be deleted, they block the delete without being named
+			if records.Len() > 0 {
+				var count int64
+				if err := WithScope(tx.Session(&gorm.Session{NewDB: true}).Model(reflect.New(ref.Schema.ModelType).Interface()).Where(clause.And(conds...)), ref.Schema).Count(&count).Error; err != nil {
+					return nil, err
+				}
+				if hidden := int64(records.Len()) - count; hidden > 0 {
+					blocking = append(blocking, message.GetPrinter(c).Sprintf("%s: %d record non accessibili", ref.Label, hidden))
+					continue
+				}
+			}
+			for i := 0; i < records.Len(); i++ {
+				nested, err := blockingReferences(c, tx, ref.Schema, records.Index(i).Addr(), visited)
+				if err != nil {
+					return nil, err
+				}
+				blocking = append(blocking, nested...)
+			}
+			continue
+		}
+
+		var count int64
+		if err := tx.Session(&gorm.Session{NewDB: true}).Model(reflect.New(ref.Schema.ModelType).Interface()).Where(clause.And(conds...)).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			continue
+		}
+		// Only the records in the scope of the request are named, the others are counted
+		records := reflect.New(reflect.SliceOf(ref.Schema.ModelType))
+		if err := WithScope(tx.Session(&gorm.Session{NewDB: true}), ref.Schema).Where(clause.And(conds...)).Limit(maxBlockingRecords).Find(records.Interface()).Error; err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for i := 0; i < records.Elem().Len(); i++ {
+			names = append(names, referenceDisplayName(c, tx, ref.Schema, records.Elem().Index(i)))
+		}
+		if len(names) == 0 {
+			blocking = append(blocking, message.GetPrinter(c).Sprintf("%s: %d record non accessibili", ref.Label, count))
+			continue
+		}
+		text := ref.Label + ": " + strings.Join(names, ", ")
+		if more := count - int64(len(names)); more > 0 {
+			text = message.GetPrinter(c).Sprintf("%s e altri %d", text, more)
+		}
+		blocking = append(blocking, text)
+	}
+	return blocking, nil
+}
+
+// referenceDisplayName returns the DISPLAY_NAME of the record, or its keys when the model has none
+func referenceDisplayName(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, record reflect.Value) string {
+	keys := audit.Keys(modelSchema, record)
+	if _, ok := reflect.PointerTo(modelSchema.ModelType).MethodByName("QueryDISPLAY_NAME"); !ok {
+		return keys
+	}
+	dialector, err := dialectors.ByDB(tx)
+	if err != nil {
+		return keys
+	}
+	primaries := map[string]interface{}{}
+	for _, field := range modelSchema.PrimaryFields {
+		primaries[field.DBName], _ = field.ValueOf(context.Background(), record)
+	}
+	args := query.QueryArgs{Sel: "DISPLAY_NAME", Primaries: primaries, Model: reflect.New(modelSchema.ModelType).Interface()}
+	if err := query.Query(c, tx, &args, query.QueryConfig{Dialector: dialector}); err != nil || len(args.Result) == 0 {
+		return keys
+	}
+	if name, ok := args.Result[0]["DISPLAY_NAME"].(string); ok && name != "" {
+		return name
+	}
+	return keys
+}
+
+func deleteReferences(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value, visited map[string]struct{}) error {
+	if !visitReference(visited, modelSchema, modelVal) {
+		return nil
+	}
+	refs, err := References(tx, modelSchema)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		conds, ok := referenceConditions(ref, modelVal)
+		if !ok || ref.OnDelete == OnDeleteRestrict {
+			continue
+		}
+		if ref.OnDelete == OnDeleteSetNull {
+			values := map[string]any{}
+			for _, field := range ref.ForeignKeys {
+				values[field.DBName] = nil
+			}
+			if err := tx.Session(&gorm.Session{NewDB: true}).Table(ref.Schema.Table).Where(clause.And(conds...)).Updates(values).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if ref.Join {
+			if err := tx.Session(&gorm.Session{NewDB: true}).Table(ref.Schema.Table).Where(clause.And(conds...)).Delete(reflect.New(ref.Schema.ModelType).Interface()).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		records, err := referencingRecords(WithScope(tx.Session(&gorm.Session{NewDB: true}), ref.Schema), ref, conds)
+		if err != nil {
+			return err
+		}
+		if records.Len() > 0 {
+			// The cascade deletes only the records that the request could delete directly
+			if err := permissions.Delete(reflect.New(ref.Schema.ModelType).Interface())(c); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < records.Len(); i++ {
+			record := records.Index(i).Addr()
+			if err := deleteReferences(c, tx, ref.Schema, record, visited); err != nil {
+				return err
+			}
+			snapshot, err := audit.Take(tx, ref.Schema, record)
+			if err != nil {
+				return err
+			}
+			if err := tx.Session(&gorm.Session{NewDB: true}).Delete(record.Interface()).Error; err != nil {
+				return err
+			}
+			if snapshot != nil {
+				if err := audit.Record(c, tx, ref.Schema, audit.Delete, record, snapshot); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
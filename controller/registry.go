@@ -10,6 +10,8 @@ func RegisterModels(models ...any) {
 	for _, model := range models {
 		ModelByName[utils.Name(model)] = model
 	}
+	// The references are derived from all the registered models
+	referencesByTable.Clear()
 }
 
 func RegisterControllers(controllers ...any) {
@@ -19,6 +21,8 @@ func RegisterControllers(controllers ...any) {
 			ControllerByModel[utils.Name(m.Model())] = controller
 		}
 	}
+	// The batch reaches the controllers registered after its first use
+	resetBatchEngine()
 }
 
 func RegisterModelControllers(controllers ...Modeler) {
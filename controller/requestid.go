@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"api_core/app"
+	"api_core/request"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from the clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+/*
+RequestID assigns the request ID, propagating the X-Request-ID header when sent or generating a new one, and echoes it in the response.
+The request-scoped logger, returned by request.Logger, carries the ID and is also set in the context of the http.Request, so that the SQL logs of the request include it.
+When the request is completed it logs the method, the path, the status and the duration.
+*/
+func RequestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	c.Set(request.RequestIDKey, id)
+	c.Header(RequestIDHeader, id)
+
+	logger := app.Logger.With("requestId", id)
+	c.Set(app.LoggerKey, logger)
+	c.Request = c.Request.WithContext(app.ContextWithLogger(c.Request.Context(), logger))
+
+	start := time.Now()
+	c.Next()
+	logger.InfoContext(c, "request", "method", c.Request.Method, "path", c.Request.URL.Path, "status", c.Writer.Status(), "elapsed", time.Since(start))
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestCounter distinguishes the IDs generated in the same nanosecond when the random source fails
+var requestCounter atomic.Uint64
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		binary.BigEndian.PutUint64(id, uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(id[8:], requestCounter.Add(1))
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{"0f8fad5b-d9cb-469f-a165-70867728950e", true},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{"accentèd", false},
+	}
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.want {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	id := newRequestID()
+	if len(id) != 32 || !validRequestID(id) {
+		t.Errorf("newRequestID() = %q, want 32 hex digits", id)
+	}
+	if id == newRequestID() {
+		t.Errorf("newRequestID() returned %q twice", id)
+	}
+}
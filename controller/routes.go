@@ -2,6 +2,7 @@ package controller
 
 import (
 	"api_core/app"
+	"api_core/audit"
 	"api_core/message"
 	"api_core/permissions"
 	"api_core/query"
@@ -100,6 +101,9 @@ func ModelPostHandler(modelGetter func() any) gin.HandlerFunc {
 			message.InvalidJSON(c).Write(c)
 			return
 		}
+		if AbortIfError(c, CheckWritableFields(c, mdl, jsonData)) {
+			return
+		}
 
 		if jsonData[0] == '[' {
 			mdlSlice := reflect.New(reflect.SliceOf(reflect.TypeOf(mdl))).Interface()
@@ -144,18 +148,30 @@ func ModelPatchOneHandler(modelGetter func() any) gin.HandlerFunc {
 		if AbortIfError(c, err) {
 			return
 		}
+		err = CheckWritableFields(c, mdl, jsonData)
+		if AbortIfError(c, err) {
+			return
+		}
 		err = GetPathParams(c, mdl, primaryFields, mdl)
 		if AbortIfError(c, err) {
 			return
 		}
-		err = LoadAndValidateMap(c, jsonData, jsonMap, modelType)
+		err = LoadModel(c, jsonData, &jsonMap)
 		if AbortIfError(c, err) {
 			return
 		}
+		if len(jsonMap) == 0 {
+			message.Unprocessable(c).Write(c)
+			return
+		}
 		err = GetPathParams(c, mdl, primaryFields, &jsonMap)
 		if AbortIfError(c, err) {
 			return
 		}
+		err = ValidatePatchMaps(c, request.DB(c), []map[string]interface{}{jsonMap}, modelType)
+		if AbortIfError(c, err) {
+			return
+		}
 		err = UpdateToDb(c, mdl, jsonMap)
 		if AbortIfError(c, err) {
 			return
@@ -175,20 +191,32 @@ func ModelPatchHandler(modelGetter func() any) gin.HandlerFunc {
 		if AbortIfError(c, msg) {
 			return
 		}
-		msg = LoadAndValidateMaps(c, jsonData, &jsonMaps, modelType)
+		msg = CheckWritableFields(c, mdl, jsonData)
 		if AbortIfError(c, msg) {
 			return
 		}
+		msg = LoadModel(c, jsonData, &jsonMaps)
+		if AbortIfError(c, msg) {
+			return
+		}
+		if len(jsonMaps) == 0 {
+			message.Unprocessable(c).Write(c)
+			return
+		}
 		msg = ValidateMapsPrimaries(c, jsonMaps, utils.GetPrimaryFields(modelType))
 		if AbortIfError(c, msg) {
 			return
 		}
+		msg = ValidatePatchMaps(c, request.DB(c), jsonMaps, modelType)
+		if AbortIfError(c, msg) {
+			return
+		}
 		if len(jsonMaps) > 0 {
 			db := request.DB(c).Session(&gorm.Session{CreateBatchSize: 50})
 
 			modelSliceVal := reflect.ValueOf(mdlSlice).Elem()
 
-			modelSchema, err := schema.Parse(modelSliceVal.Index(0), &sync.Map{}, db.NamingStrategy)
+			modelSchema, err := schema.Parse(mdl, &sync.Map{}, db.NamingStrategy)
 			if err != nil {
 				message.InternalServerError(c).Write(c)
 				return
@@ -202,27 +230,91 @@ func ModelPatchHandler(modelGetter func() any) gin.HandlerFunc {
 				}
 			}
 
-			db.Session(&gorm.Session{FullSaveAssociations: true}).Transaction(func(tx *gorm.DB) error {
+			// The version of each row is sent in the $version property
+			versions := []struct {
+				Version string `json:"$version"`
+			}{}
+			if IsVersioned(mdl) {
+				msg = LoadModel(c, jsonData, &versions)
+				if AbortIfError(c, msg) {
+					return
+				}
+			}
+
+			err = db.Session(&gorm.Session{FullSaveAssociations: true}).Transaction(func(tx *gorm.DB) error {
+				// The scope is checked first, so that the rows out of scope don't show in the errors of the unique fields
+				for i := range jsonMaps {
+					if err := CheckNestedScope(c, tx, modelSchema, modelSliceVal.Index(i).Addr()); err != nil {
+						return err
+					}
+				}
+				// The unique fields are checked on all the records together, to find the duplicates within the request
+				records := make([]reflect.Value, len(jsonMaps))
+				changes := make([]map[string]struct{}, len(jsonMaps))
+				for i, values := range jsonMaps {
+					var err error
+					records[i], changes[i], err = mergedRecord(tx, modelSchema, modelSliceVal.Index(i).Addr(), values)
+					if err != nil {
+						return err
+					}
+				}
+				if err := CheckUniqueFields(c, tx, modelSchema, records, changes); err != nil {
+					return err
+				}
+
 				for i, values := range jsonMaps {
 					modelVal := modelSliceVal.Index(i).Addr()
-					e := DeleteRelations(c, tx, modelVal, modelSchema)
+					var version *RowVersion
+					if i < len(versions) && versions[i].Version != "" {
+						var err error
+						version, err = CheckRowVersion(c, tx, modelSchema, PrimaryKeys(modelSchema, modelVal), ParseETags(versions[i].Version))
+						if err != nil {
+							return err
+						}
+					}
+					snapshot, e := audit.Take(tx, modelSchema, modelVal)
+					if e != nil {
+						return e
+					}
+					e = DeleteRelations(c, tx, modelVal, modelSchema)
 					if e != nil {
 						return e
 					}
 					if tx.Error != nil {
 						return tx.Error
 					}
-					res := tx.Model(modelVal.Interface()).Updates(values)
+					IncrementVersion(modelSchema, values)
+					upd := omitMany2Many(WithScope(tx.Model(modelVal.Interface()), modelSchema), modelSchema)
+					if version != nil {
+						upd = version.Guard(upd)
+					}
+					res := upd.Updates(values)
 					if res.Error != nil {
 						return res.Error
 					}
+					if res.RowsAffected == 0 {
+						if version != nil {
+							return message.PreconditionFailed(c)
+						}
+						return message.ItemNotFound(c)
+					}
+					if e := SaveMany2Many(c, tx, modelVal, modelSchema); e != nil {
+						return e
+					}
+					e = audit.Record(c, tx, modelSchema, audit.Update, modelVal, snapshot)
+					if e != nil {
+						return e
+					}
 				}
 
 				return nil
 			})
+			if AbortIfError(c, err) {
+				return
+			}
 		}
 
-		c.JSON(http.StatusOK, mdlSlice)
+		AbortIfError(c, WriteSaved(c, mdlSlice))
 	}
 }
 
@@ -302,6 +394,13 @@ func PostHandler(controller Modeler) gin.HandlerFunc {
 	return ModelPostHandler(controller.Model)
 }
 
+func ImportHandler(controller Modeler) gin.HandlerFunc {
+	if h, ok := controller.(Importer); ok {
+		return h.Import
+	}
+	return ModelImportHandler(controller.Model)
+}
+
 func PatchHandler(controller Modeler) gin.HandlerFunc {
 	if h, ok := controller.(PatchHandlerer); ok {
 		return h.Patch
@@ -448,13 +547,30 @@ func Routes(controller any) []Route {
 			)
 		}
 
+		if m, ok := model.(permissions.ModelWithPermissionsGet); ok && len(urlPrimaryFields) > 0 && audit.Enabled(reflect.TypeOf(model)) {
+			addToMap(
+				Route{
+					Method:      http.MethodGet,
+					Pattern:     urlPrimaryFields + "/history",
+					Permissions: m.PermissionsGet,
+					Handler:     ModelHistoryHandler(modeler.Model),
+				},
+			)
+		}
+
 		if m, ok := model.(permissions.ModelWithPermissionsPost); ok {
 			addToMap(
 				Route{
 					Method:      http.MethodPost,
 					Pattern:     "",
 					Permissions: m.PermissionsPost,
-					Handler:     PostHandler(modeler),
+					Handler:     DryRun(PostHandler(modeler)),
+				},
+				Route{
+					Method:      http.MethodPost,
+					Pattern:     "import",
+					Permissions: m.PermissionsPost,
+					Handler:     DryRun(ImportHandler(modeler)),
 				},
 			)
 		}
@@ -465,13 +581,13 @@ func Routes(controller any) []Route {
 					Method:      http.MethodPatch,
 					Pattern:     "",
 					Permissions: m.PermissionsPatch,
-					Handler:     PatchHandler(modeler),
+					Handler:     DryRun(PatchHandler(modeler)),
 				},
 				Route{
 					Method:      http.MethodPatch,
 					Pattern:     urlPrimaryFields,
 					Permissions: m.PermissionsPatch,
-					Handler:     PatchOneHandler(modeler),
+					Handler:     DryRun(PatchOneHandler(modeler)),
 				},
 			)
 		}
@@ -482,7 +598,7 @@ func Routes(controller any) []Route {
 					Method:      http.MethodDelete,
 					Pattern:     urlPrimaryFields,
 					Permissions: m.PermissionsDelete,
-					Handler:     DeleteHandler(modeler),
+					Handler:     DryRun(DeleteHandler(modeler)),
 				},
 			)
 		}
@@ -492,6 +608,14 @@ func Routes(controller any) []Route {
 		addToMap(router.Routes()...)
 	}
 
+	// Every POST can be retried safely with the Idempotency-Key header
+	for key, route := range routeMap {
+		if route.Method == http.MethodPost {
+			route.Handler = Idempotent(route.Handler)
+			routeMap[key] = route
+		}
+	}
+
 	return slices.Collect(maps.Values(routeMap))
 }
 
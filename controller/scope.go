@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	"api_core/message"
+	"api_core/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// WithScope restricts the write to the rows satisfying the DefaultConditions of the model, so that the scope is checked atomically with it
+func WithScope(tx *gorm.DB, modelSchema *schema.Schema) *gorm.DB {
+	condMdl, ok := reflect.New(modelSchema.ModelType).Interface().(model.ConditionsModel)
+	if !ok {
+		return tx
+	}
+	if query, args := condMdl.DefaultConditions(tx, modelSchema.Table); query != "" {
+		return tx.Where("("+query+")", args...)
+	}
+	return tx
+}
+
+/*
+CheckScope verifies that the existing record identified by the primary keys of modelVal satisfies the DefaultConditions of its model, like the rows returned by a GET.
+It returns ItemNotFound for a record out of scope, records that don't exist yet are left to the write, which creates or ignores them.
+*/
+func CheckScope(c *gin.Context, db *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value) error {
+	condMdl, ok := reflect.New(modelSchema.ModelType).Interface().(model.ConditionsModel)
+	if !ok {
+		return nil
+	}
+	keys := []clause.Expression{}
+	for _, field := range modelSchema.PrimaryFields {
+		val, zero := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		if zero {
+			// New records have no scope to check
+			return nil
+		}
+		keys = append(keys, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true}).Table(modelSchema.Table).Where(clause.And(keys...))
+	query, args := condMdl.DefaultConditions(tx, modelSchema.Table)
+	if query == "" {
+		return nil
+	}
+	var count int64
+	if err := tx.Session(&gorm.Session{}).Where("("+query+")", args...).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := tx.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return message.ItemNotFound(c)
+	}
+	return nil
+}
+
+// CheckNestedScope applies CheckScope to the record and to the records of its has one and has many relations, at any depth
+func CheckNestedScope(c *gin.Context, db *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value) error {
+	if err := CheckScope(c, db, modelSchema, modelVal); err != nil {
+		return err
+	}
+	item := reflect.Indirect(modelVal)
+	if !item.IsValid() {
+		return nil
+	}
+	rels := append(append([]*schema.Relationship{}, modelSchema.Relationships.HasOne...), modelSchema.Relationships.HasMany...)
+	for _, rel := range rels {
+		if !rel.Field.Updatable {
+			continue
+		}
+		value := reflect.Indirect(item.FieldByName(rel.Field.Name))
+		if !value.IsValid() {
+			continue
+		}
+		if value.Kind() != reflect.Slice {
+			if value.IsZero() {
+				continue
+			}
+			if err := CheckNestedScope(c, db, rel.FieldSchema, value); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := CheckNestedScope(c, db, rel.FieldSchema, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"strconv"
+
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StreamBatchSize is the number of rows read before they are written to the response and flushed
+var StreamBatchSize = 500
+
+// IsStreamRequest reports whether the list should be streamed, because requested with stream=1 or by default for the format, e.g. NDJSON
+func IsStreamRequest(c *gin.Context) bool {
+	encoder, ok := negotiateStreamEncoder(c)
+	if !ok {
+		return false
+	}
+	if stream := c.Query("stream"); stream != "" {
+		return stream == "1"
+	}
+	return encoder.StreamByDefault()
+}
+
+func negotiateStreamEncoder(c *gin.Context) (StreamEncoder, bool) {
+	_, encoder := NegotiateEncoder(c)
+	streamEncoder, ok := encoder.(StreamEncoder)
+	return streamEncoder, ok
+}
+
+/*
+StreamQueryResult writes the rows of the query to the response while they are read from the database, without holding the whole result in memory.
+Formats without a StreamEncoder and pages requested with cursors are written after reading the whole result, the nested relations are loaded in batches of StreamBatchSize rows. JSON is written as a plain array, the wrap param isn't supported.
+Once the first rows have been sent the status can't change anymore, so an error interrupts the response and is only recorded in the context.
+*/
+func StreamQueryResult(c *gin.Context, db *gorm.DB, args *query.QueryArgs, config query.QueryConfig) error {
+	encoder, ok := negotiateStreamEncoder(c)
+	if !ok || query.ShouldUseCursor(args) {
+		if err := query.Query(c, db, args, config); err != nil {
+			return err
+		}
+		return WriteQueryMapResult(c, args)
+	}
+
+	var writer RowWriter
+	begin := func() error {
+		if query.ShouldPaginate(args.PagStart, args.PagEnd) && args.Count >= 0 {
+			c.Header("X-Total-Count", strconv.Itoa(int(args.Count)))
+		}
+		OffsetLinks(c, args.PagStart, args.PagEnd, args.Count, 0).Write(c)
+		var err error
+		writer, err = encoder.Stream(c, args)
+		return err
+	}
+
+	err := query.QueryStream(c, db, args, config, StreamBatchSize, func(rows []map[string]any) error {
+		if writer == nil {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+		if err := writer.WriteRows(rows); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil && writer == nil {
+		err = begin()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		if !c.Writer.Written() {
+			return err
+		}
+		c.Error(err)
+		c.Abort()
+		return nil
+	}
+	c.Writer.Flush()
+	return nil
+}
@@ -145,8 +145,18 @@ func GetStructInfo(c *gin.Context, schem *schema.Schema, relations [][]string) S
 	}
 
 	for _, field := range schem.Fields {
+		// The fields are described as the caller may access them
+		access := permissions.Field(c, schem, field)
+		if access == permissions.FieldHidden || (access == permissions.FieldReadOnly && c.Query("w") == "1") {
+			continue
+		}
 		if field.DBName != "" && checkFn(checkFieldFns, field) {
-			structInfo.Fields = append(structInfo.Fields, GetFieldInfo(c, field))
+			fieldInfo := GetFieldInfo(c, field)
+			if access == permissions.FieldReadOnly {
+				fieldInfo.Updatable = false
+				fieldInfo.Creatable = false
+			}
+			structInfo.Fields = append(structInfo.Fields, fieldInfo)
 		}
 		if _, ok := field.Tag.Lookup("query"); ok {
 			fieldInfo := GetFieldInfo(c, field)
@@ -170,7 +180,7 @@ func GetStructInfo(c *gin.Context, schem *schema.Schema, relations [][]string) S
 		structInfo.UpdateConditions = updateModel.UpdateConditions()
 	}
 	var hasDisplay bool
-	index := 0
+	index := -1
 	i := 0
 	for ; i < len(structInfo.Fields) && !hasDisplay; i++ {
 		if structInfo.Fields[i].Field == "DISPLAY_NAME" {
@@ -178,7 +188,8 @@ func GetStructInfo(c *gin.Context, schem *schema.Schema, relations [][]string) S
 		}
 		hasDisplay = structInfo.Fields[i].Descriptive != ""
 	}
-	if !hasDisplay {
+	// DISPLAY_NAME might be missing when hidden by the field permissions
+	if !hasDisplay && index != -1 {
 		structInfo.Fields = append(structInfo.Fields[:index], structInfo.Fields[index+1:]...)
 	}
 	return structInfo
@@ -201,7 +212,7 @@ func GetFieldInfo(c *gin.Context, field *schema.Field) FieldInfo {
 
 	fieldInfo := FieldInfo{
 		Field:           field.Name,
-		Label:           FieldToString(field),
+		Label:           FieldLabel(field),
 		Descriptive:     field.Tag.Get("desc"),
 		Type:            strings.ReplaceAll(field.StructField.Type.String(), "*", ""),
 		Primary:         strings.Contains(field.Tag.Get("gorm"), "primaryKey"),
@@ -213,11 +224,6 @@ func GetFieldInfo(c *gin.Context, field *schema.Field) FieldInfo {
 		Creatable:       field.Creatable,
 	}
 
-	label := field.Tag.Get("label")
-	if label != "" {
-		fieldInfo.Label = label
-	}
-
 	validationsTag := field.Tag.Get("validate")
 	if len(validationsTag) > 0 {
 		validations := strings.Split(validationsTag, ",")
@@ -288,6 +294,14 @@ func GetRelationInfo(c *gin.Context, rel *schema.Relationship, relations [][]str
 	return relationInfo
 }
 
+// FieldLabel returns the label tag of the field, or its name in sentence case
+func FieldLabel(field *schema.Field) string {
+	if label := field.Tag.Get("label"); label != "" {
+		return label
+	}
+	return FieldToString(field)
+}
+
 func FieldToString(field *schema.Field) string {
 	return utils.SentenceCase(strings.ReplaceAll(field.Name, "_", " "))
 }
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"api_core/message"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+/*
+UniqueConstraints returns the groups of fields whose values must be unique, read from the unique tags and the unique indexes of the schema.
+Partial indexes are left to the database, since their condition can't be evaluated.
+*/
+func UniqueConstraints(modelSchema *schema.Schema) [][]*schema.Field {
+	constraints := [][]*schema.Field{}
+	seen := map[string]struct{}{}
+	add := func(fields []*schema.Field) {
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.DBName
+		}
+		key := strings.Join(names, ",")
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			constraints = append(constraints, fields)
+		}
+	}
+	for _, field := range modelSchema.Fields {
+		if field.Unique && field.DBName != "" {
+			add([]*schema.Field{field})
+		}
+	}
+	indexes := modelSchema.ParseIndexes()
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := indexes[name]
+		if index.Class != "UNIQUE" || index.Where != "" {
+			continue
+		}
+		fields := []*schema.Field{}
+		for _, option := range index.Fields {
+			if option.Field != nil && option.Expression == "" {
+				fields = append(fields, option.Field)
+			}
+		}
+		if len(fields) == len(index.Fields) && len(fields) > 0 {
+			add(fields)
+		}
+	}
+	return constraints
+}
+
+/*
+CheckUniqueFields verifies the unique constraints of the model before saving the records, consistently for every database.
+A constraint is checked on a record when at least one of its fields is in changed, a nil changed set means a new record with all the fields set.
+The values are compared with the other records of the table and with the ones of the other records sent, a constraint with a NULL value is always satisfied.
+It fails with DuplicateValues naming the fields of each violated constraint.
+*/
+func CheckUniqueFields(c *gin.Context, tx *gorm.DB, modelSchema *schema.Schema, records []reflect.Value, changed []map[string]struct{}) error {
+	constraints := UniqueConstraints(modelSchema)
+	if len(constraints) == 0 {
+		return nil
+	}
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	errs := []message.ValidationError{}
+	for _, fields := range constraints {
+		sent := map[string]struct{}{}
+		for i, record := range records {
+			record = reflect.Indirect(record)
+			if changed != nil && changed[i] != nil && !changesAny(changed[i], fields) {
+				continue
+			}
+			conds := []clause.Expression{}
+			values := make([]string, len(fields))
+			isNull := false
+			for j, field := range fields {
+				val, _ := field.ValueOf(context.Background(), record)
+				if rv := reflect.ValueOf(val); !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+					isNull = true
+					break
+				}
+				values[j] = fmt.Sprint(reflect.Indirect(reflect.ValueOf(val)).Interface())
+				conds = append(conds, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+			}
+			if isNull {
+				continue
+			}
+
+			key := strings.Join(values, "\x00")
+			duplicate := false
+			if _, ok := sent[key]; ok {
+				duplicate = true
+			} else {
+				sent[key] = struct{}{}
+				exclude := []clause.Expression{}
+				for _, field := range modelSchema.PrimaryFields {
+					if val, zero := field.ValueOf(context.Background(), record); !zero {
+						exclude = append(exclude, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+					}
+				}
+				q := tx.Model(reflect.New(modelSchema.ModelType).Interface()).Where(clause.And(conds...))
+				if len(exclude) > 0 && len(exclude) == len(modelSchema.PrimaryFields) {
+					q = q.Where(clause.Not(clause.And(exclude...)))
+				}
+				var count int64
+				if err := q.Count(&count).Error; err != nil {
+					return err
+				}
+				duplicate = count > 0
+			}
+			if duplicate {
+				errs = append(errs, uniqueError(c, i, fields))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return message.DuplicateValues(c, errs...)
+	}
+	return nil
+}
+
+func changesAny(changed map[string]struct{}, fields []*schema.Field) bool {
+	for _, field := range fields {
+		if _, ok := changed[field.Name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueError(c *gin.Context, row int, fields []*schema.Field) message.ValidationError {
+	names := make([]string, len(fields))
+	labels := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = jsonName(field.StructField)
+		labels[i] = FieldLabel(field)
+	}
+	param := ""
+	if len(labels) > 1 {
+		param = labels[len(labels)-1]
+		labels = labels[:len(labels)-1]
+	}
+	return message.ValidationError{
+		Row:     row,
+		Field:   strings.Join(names, ","),
+		Rule:    "unique",
+		Param:   param,
+		Message: message.RuleText(c, strings.Join(labels, ", "), "unique", param),
+	}
+}
+
+/*
+mergedRecord returns the record updated by values as it will be saved, loading from the database the fields not changed, along with the names of the changed fields.
+When the record is not found the model is returned as sent.
+*/
+func mergedRecord(tx *gorm.DB, modelSchema *schema.Schema, modelVal reflect.Value, values any) (reflect.Value, map[string]struct{}, error) {
+	changed := map[string]struct{}{}
+	valuesMap, ok := values.(map[string]interface{})
+	if !ok {
+		for _, field := range modelSchema.Fields {
+			changed[field.Name] = struct{}{}
+		}
+		return modelVal, changed, nil
+	}
+	for key := range valuesMap {
+		if field := jsonField(modelSchema, key); field != nil && field.DBName != "" {
+			changed[field.Name] = struct{}{}
+		}
+	}
+
+	keys := []clause.Expression{}
+	for _, field := range modelSchema.PrimaryFields {
+		val, zero := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		if zero {
+			return modelVal, changed, nil
+		}
+		keys = append(keys, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+	}
+	if len(keys) == 0 {
+		return modelVal, changed, nil
+	}
+	record := reflect.New(modelSchema.ModelType)
+	res := tx.Session(&gorm.Session{NewDB: true}).Where(clause.And(keys...)).Limit(1).Find(record.Interface())
+	if res.Error != nil {
+		return modelVal, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return modelVal, changed, nil
+	}
+	for name := range changed {
+		field := modelSchema.LookUpField(name)
+		val, _ := field.ValueOf(context.Background(), reflect.Indirect(modelVal))
+		if err := field.Set(context.Background(), record.Elem(), val); err != nil {
+			return modelVal, nil, err
+		}
+	}
+	return record, changed, nil
+}
@@ -3,13 +3,20 @@ package controller
 import (
 	"api_core/message"
 	"api_core/model"
+	"api_core/utils"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 func GetPathParams(c *gin.Context, model interface{}, fields []string, destination interface{}) error {
@@ -146,34 +153,93 @@ func LoadModel(c *gin.Context, jsonData []byte, model interface{}) error {
 }
 
 func ValidateStruct(c *gin.Context, mdl interface{}) error {
+	errs, err := validationErrors(c, mdl, 0)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return message.ValidationFailed(c, errs...)
+	}
+	return nil
+}
+
+/*
+validationErrors validates the record at index row of the body, the errors returned by ValidationModel are merged with the ones of the validate tags.
+A message of ValidationModel which isn't a validation failure is returned as error, keeping its status.
+*/
+func validationErrors(c *gin.Context, mdl interface{}, row int) ([]message.ValidationError, error) {
+	errs := []message.ValidationError{}
 	if validationModel, ok := mdl.(model.ValidationModel); ok {
 		if msg := validationModel.Validate(c); msg != nil {
-			return msg
+			if custom := message.ValidationErrorsOf(msg); custom != nil {
+				for _, e := range custom {
+					e.Row = row
+					errs = append(errs, e)
+				}
+			} else if m, ok := msg.(*message.Msg); ok && m.Status != http.StatusUnprocessableEntity {
+				return nil, msg
+			} else {
+				errs = append(errs, message.ValidationError{Row: row, Rule: "custom", Message: msg.Error()})
+			}
 		}
 	}
-	validate := validator.New()
-	err := validate.Struct(mdl)
-	if err != nil {
-		if _, ok := err.(*validator.InvalidValidationError); ok {
-			return nil
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(validator.New().Struct(mdl), &validationErrs) {
+		typ := reflect.Indirect(reflect.ValueOf(mdl)).Type()
+		for _, e := range validationErrs {
+			field, label := validationField(c, typ, e.StructNamespace())
+			errs = append(errs, message.ValidationError{Row: row, Field: field, Rule: e.Tag(), Param: e.Param(), Message: message.RuleText(c, label, e.Tag(), e.Param())})
 		}
+	}
+	return errs, nil
+}
 
-		campiObbligatori := ""
-		for _, err := range err.(validator.ValidationErrors) {
-			campiObbligatori += err.Field() + " " + err.ActualTag() + " " + err.Param()
+// validationField returns the path of the field with the JSON names and its translated label, from the namespace of a validator error
+func validationField(c *gin.Context, typ reflect.Type, namespace string) (string, string) {
+	pieces := strings.Split(namespace, ".")[1:]
+	path := make([]string, len(pieces))
+	label := namespace
+	for i, piece := range pieces {
+		name, index := piece, ""
+		if pos := strings.Index(piece, "["); pos != -1 {
+			name, index = piece[:pos], piece[pos:]
+		}
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
 		}
+		path[i] = piece
+		label = name
+		if typ.Kind() != reflect.Struct {
+			continue
+		}
+		if field, ok := typ.FieldByName(name); ok {
+			path[i] = jsonName(field) + index
+			label = structFieldLabel(field)
+			typ = field.Type
+		}
+	}
+	return strings.Join(path, "."), message.Translate(c, label)
+}
 
-		return errors.New(campiObbligatori)
+// jsonName returns the name of the field in the JSON body
+func jsonName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
 	}
-	return nil
+	return field.Name
 }
 
-func ValidateModel(c *gin.Context, model interface{}) error {
-	err := ValidateStruct(c, model)
-	if err != nil {
-		return message.Unprocessable(c).Text(err.Error())
+// structFieldLabel returns the label tag of the field, or its name in sentence case like FieldLabel
+func structFieldLabel(field reflect.StructField) string {
+	if label := field.Tag.Get("label"); label != "" {
+		return label
 	}
-	return nil
+	return utils.SentenceCase(strings.ReplaceAll(field.Name, "_", " "))
+}
+
+func ValidateModel(c *gin.Context, model interface{}) error {
+	return ValidateStruct(c, model)
 }
 
 func ValidateModels(c *gin.Context, models interface{}) error {
@@ -183,63 +249,180 @@ func ValidateModels(c *gin.Context, models interface{}) error {
 	if typ.Kind() != reflect.Slice {
 		return message.ExpectedSlice(c)
 	}
-	res := ""
+	errs := []message.ValidationError{}
 	for i := 0; i < modelsSlice.Len(); i++ {
-		err := ValidateStruct(c, modelsSlice.Index(i).Interface())
+		rowErrs, err := validationErrors(c, modelsSlice.Index(i).Interface(), i)
 		if err != nil {
-			res += "Riga " + strconv.Itoa(i) + ": " + err.Error() + "\n"
+			return err
 		}
+		errs = append(errs, rowErrs...)
 	}
 
-	if len(res) > 0 {
-		return message.Unprocessable(c).Text(res)
+	if len(errs) > 0 {
+		return message.ValidationFailed(c, errs...)
 	}
 	return nil
 }
 
-func validateVar(c *gin.Context, value interface{}, rules string, field string) message.Message {
+/*
+ValidateMap validates each value of the map in isolation with the rules of its field, see ValidatePatchMaps to validate the whole record.
+The keys sent by JSON name are renamed to the name of their field, as GORM would take them as column names.
+The keys not matching any field are rejected, except the properties starting with $ like $version, which are removed.
+*/
+func ValidateMap(c *gin.Context, jsonMap map[string]interface{}, modelType reflect.Type) []message.ValidationError {
+	errs := []message.ValidationError{}
 	validate := validator.New()
-	err := validate.Var(value, rules)
+	renamed := map[string]interface{}{}
+	for key, value := range jsonMap {
+		field, found := mapField(modelType, key)
+		if !found && strings.HasPrefix(key, "$") {
+			delete(jsonMap, key)
+		} else if !found {
+			errs = append(errs, message.ValidationError{Field: key, Rule: "unknown", Message: message.RuleText(c, key, "unknown", "")})
+		} else {
+			if key != field.Name {
+				delete(jsonMap, key)
+				renamed[field.Name] = value
+			}
+			var validationErrs validator.ValidationErrors
+			if errors.As(validate.Var(value, field.Tag.Get("validate")), &validationErrs) {
+				label := message.Translate(c, structFieldLabel(field))
+				for _, e := range validationErrs {
+					errs = append(errs, message.ValidationError{Field: jsonName(field), Rule: e.Tag(), Param: e.Param(), Message: message.RuleText(c, label, e.Tag(), e.Param())})
+				}
+			}
+		}
+	}
+	for name, value := range renamed {
+		jsonMap[name] = value
+	}
+	return errs
+}
+
+// mapField finds the field of a key of a PATCH map, by name or JSON name
+func mapField(modelType reflect.Type, key string) (reflect.StructField, bool) {
+	if field, found := modelType.FieldByName(key); found {
+		return field, true
+	}
+	for _, field := range reflect.VisibleFields(modelType) {
+		if field.IsExported() && jsonName(field) == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+/*
+ValidatePatchMaps validates the changes of each map against the record they update, loaded from the database and merged with them, so cross-field rules like required_with and ValidationModel apply as on creation.
+Only the errors of rules involving the changed fields are reported. The records not found are validated field by field, the update will ignore them.
+*/
+func ValidatePatchMaps(c *gin.Context, db *gorm.DB, jsonMaps []map[string]interface{}, modelType reflect.Type) error {
+	modelSchema, err := schema.Parse(reflect.New(modelType).Interface(), &sync.Map{}, db.NamingStrategy)
 	if err != nil {
-		return message.InvalidFieldValue(c, field, rules, value)
+		return err
+	}
+	errs := []message.ValidationError{}
+	for i, jsonMap := range jsonMaps {
+		rowErrs, err := validatePatchMap(c, db, modelSchema, jsonMap, i)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, rowErrs...)
+	}
+	if len(errs) > 0 {
+		return message.ValidationFailed(c, errs...)
 	}
 	return nil
 }
 
-func ValidateMap(c *gin.Context, jsonMap map[string]interface{}, modelType reflect.Type) []error {
-	var errors []error
+func validatePatchMap(c *gin.Context, db *gorm.DB, modelSchema *schema.Schema, jsonMap map[string]interface{}, row int) ([]message.ValidationError, error) {
+	errs := ValidateMap(c, jsonMap, modelSchema.ModelType)
+	for i := range errs {
+		errs[i].Row = row
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+
+	changed := map[string]struct{}{}
+	// The keys have been renamed to the names of the fields, the record is decoded by JSON name
+	jsonValues := map[string]interface{}{}
 	for key, value := range jsonMap {
-		field, found := modelType.FieldByName(key)
-		if found {
-			rules := field.Tag.Get("validate")
-			msg := validateVar(c, value, rules, field.Name)
-			if msg != nil {
-				errors = append(errors, msg)
-			}
-		} else {
-			delete(jsonMap, key)
+		field, _ := mapField(modelSchema.ModelType, key)
+		changed[field.Name] = struct{}{}
+		changed[jsonName(field)] = struct{}{}
+		jsonValues[jsonName(field)] = value
+	}
+
+	record := reflect.New(modelSchema.ModelType)
+	// A record out of scope isn't merged, so that its values don't show in the errors
+	tx := WithScope(db.Session(&gorm.Session{NewDB: true}).Model(record.Interface()), modelSchema)
+	for _, field := range modelSchema.PrimaryFields {
+		val, ok := jsonMap[field.Name]
+		if !ok {
+			return errs, nil
 		}
+		tx = tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: val})
+	}
+	res := tx.Limit(1).Find(record.Interface())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errs, nil
+	}
+	data, err := json.Marshal(jsonValues)
+	if err != nil {
+		return nil, err
 	}
-	return errors
+	if err := json.Unmarshal(data, record.Interface()); err != nil {
+		return nil, message.InvalidJSON(c).Text(err.Error())
+	}
+
+	merged, err := validationErrors(c, record.Interface(), row)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range merged {
+		if patchAffects(e, changed) {
+			errs = append(errs, e)
+		}
+	}
+	return errs, nil
 }
 
-func ValidateMaps(c *gin.Context, jsonMaps []map[string]interface{}, modelType reflect.Type) error {
-	var err string
-	for i, jsonMap := range jsonMaps {
-		var errString string
-		errors := ValidateMap(c, jsonMap, modelType)
-		for _, err := range errors {
-			errString += err.Error() + "\n"
+// patchAffects reports whether the error concerns a changed field, directly or as param of the rule, the errors of ValidationModel without a field always do
+func patchAffects(e message.ValidationError, changed map[string]struct{}) bool {
+	if e.Field == "" {
+		return true
+	}
+	top := e.Field
+	if pos := strings.IndexAny(top, ".["); pos != -1 {
+		top = top[:pos]
+	}
+	if _, ok := changed[top]; ok {
+		return true
+	}
+	for _, param := range strings.Fields(e.Param) {
+		if _, ok := changed[param]; ok {
+			return true
 		}
+	}
+	return false
+}
 
-		if errString != "" {
-			err += "Riga " + strconv.Itoa(i) + ":\n" + errString
+func ValidateMaps(c *gin.Context, jsonMaps []map[string]interface{}, modelType reflect.Type) error {
+	errs := []message.ValidationError{}
+	for i, jsonMap := range jsonMaps {
+		for _, e := range ValidateMap(c, jsonMap, modelType) {
+			e.Row = i
+			errs = append(errs, e)
 		}
 	}
-	if err == "" {
-		return nil
+	if len(errs) > 0 {
+		return message.ValidationFailed(c, errs...)
 	}
-	return errors.New(err)
+	return nil
 }
 
 func LoadAndValidateMap(c *gin.Context, jsonData []byte, jsonMap map[string]interface{}, modelType reflect.Type) error {
@@ -248,18 +431,14 @@ func LoadAndValidateMap(c *gin.Context, jsonData []byte, jsonMap map[string]inte
 		return msg
 	}
 
-	errors := ValidateMap(c, jsonMap, modelType)
-	var errString string
-	for _, err := range errors {
-		errString += err.Error()
-	}
+	errs := ValidateMap(c, jsonMap, modelType)
 
 	if len(jsonMap) == 0 {
 		return message.Unprocessable(c)
 	}
 
-	if len(errors) > 0 {
-		return message.Conflict(c).Text(errString)
+	if len(errs) > 0 {
+		return message.ValidationFailed(c, errs...)
 	}
 
 	return nil
@@ -272,7 +451,7 @@ func LoadAndValidateMaps(c *gin.Context, jsonData []byte, jsonMaps *[]map[string
 	}
 	err = ValidateMaps(c, *jsonMaps, modelType)
 	if err != nil {
-		return message.Conflict(c).Text(err.Error())
+		return err
 	}
 	if len(*jsonMaps) == 0 {
 		return message.Unprocessable(c)
@@ -281,21 +460,17 @@ func LoadAndValidateMaps(c *gin.Context, jsonData []byte, jsonMaps *[]map[string
 }
 
 func ValidateMapsPrimaries(c *gin.Context, jsonMaps []map[string]interface{}, primaryKeys []string) error {
-	var err string
+	errs := []message.ValidationError{}
 	for i, jsonMap := range jsonMaps {
-		var errString string
 		for _, field := range primaryKeys {
 			if jsonMap[field] == nil {
-				errString += message.InvalidFieldRequired(c, field).Error() + "\n"
+				errs = append(errs, message.ValidationError{Row: i, Field: field, Rule: "required", Message: message.RuleText(c, field, "required", "")})
 			}
 		}
-		if errString != "" {
-			err += message.RowError(c, i, "\n"+errString).Error()
-		}
 	}
 
-	if err != "" {
-		return message.Conflict(c).Text(err)
+	if len(errs) > 0 {
+		return message.ValidationFailed(c, errs...)
 	}
 	return nil
 }
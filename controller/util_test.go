@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type validateMapModel struct {
+	ID          uint
+	DESCRIPTION string `json:"description" validate:"max=5"`
+	AMOUNT      float64
+}
+
+func TestValidateMap(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     map[string]interface{}
+		want       map[string]interface{}
+		wantFields []string
+	}{
+		{
+			name:   "field names are kept",
+			values: map[string]interface{}{"ID": 1, "DESCRIPTION": "abc"},
+			want:   map[string]interface{}{"ID": 1, "DESCRIPTION": "abc"},
+		},
+		{
+			name:   "JSON names are renamed to field names",
+			values: map[string]interface{}{"ID": 1, "description": "abc"},
+			want:   map[string]interface{}{"ID": 1, "DESCRIPTION": "abc"},
+		},
+		{
+			name:   "properties starting with $ are removed",
+			values: map[string]interface{}{"ID": 1, "$version": `"3"`},
+			want:   map[string]interface{}{"ID": 1},
+		},
+		{
+			name:       "unknown keys are rejected",
+			values:     map[string]interface{}{"ID": 1, "OTHER": 2},
+			want:       map[string]interface{}{"ID": 1, "OTHER": 2},
+			wantFields: []string{"OTHER"},
+		},
+		{
+			name:       "renamed values are validated with the JSON name",
+			values:     map[string]interface{}{"description": "too long"},
+			want:       map[string]interface{}{"DESCRIPTION": "too long"},
+			wantFields: []string{"description"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			errs := ValidateMap(c, tt.values, reflect.TypeOf(validateMapModel{}))
+			if !reflect.DeepEqual(tt.values, tt.want) {
+				t.Errorf("map = %v, want %v", tt.values, tt.want)
+			}
+			fields := []string{}
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if len(fields) != len(tt.wantFields) || (len(fields) > 0 && !reflect.DeepEqual(fields, tt.wantFields)) {
+				t.Errorf("errors on %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
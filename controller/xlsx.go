@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"api_core/datatypes"
+	"api_core/message"
+	"api_core/query"
+	"api_core/utils"
+	"api_core/xlsx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WriteXLSX sends the workbook as an attachment
+func WriteXLSX(c *gin.Context, wb *xlsx.Workbook) error {
+	c.Header("Content-Type", XLSXContentType)
+	c.Header("Content-Disposition", "attachment; filename=data.xlsx")
+	c.Status(http.StatusOK)
+	return wb.Write(c.Writer)
+}
+
+/*
+QueryMapWorkbook converts the result of a query to a workbook with typed cells, the headers are the labels of the fields.
+Every nested relation is written in its own sheet, whose first column is the row of the parent record.
+*/
+func QueryMapWorkbook(c *gin.Context, info *query.ModelInfo, result []map[string]any) *xlsx.Workbook {
+	wb := xlsx.NewWorkbook()
+	addQueryMapSheet(c, wb, info.Schema.Name, info, info, nil, result, nil, nil)
+	return wb
+}
+
+func addQueryMapSheet(c *gin.Context, wb *xlsx.Workbook, name string, root, info *query.ModelInfo, path []string, rows []map[string]any, parent *xlsx.Sheet, parentRows []int) {
+	sheet := wb.AddSheet(name)
+	columns := xlsxColumns(root, info, path)
+	heading := []any{}
+	if parent != nil {
+		heading = append(heading, message.GetPrinter(c).Sprintf("Riga %s", parent.Name))
+	}
+	for _, column := range columns {
+		if column.Field != nil && column.Field.Name == column.Name {
+			heading = append(heading, message.Translate(c, FieldLabel(column.Field)))
+		} else {
+			heading = append(heading, column.Name)
+		}
+	}
+	sheet.AddRow(heading...)
+
+	nested := sortedNested(info)
+	children := make([][]map[string]any, len(nested))
+	childParents := make([][]int, len(nested))
+	for i, row := range rows {
+		values := make([]any, 0, len(heading))
+		if parent != nil {
+			values = append(values, parentRows[i])
+		}
+		for _, column := range columns {
+			values = append(values, xlsxValue(c, row[column.Name]))
+		}
+		sheet.AddRow(values...)
+
+		for j, key := range nested {
+			switch v := row[key[strings.LastIndex(key, ".")+1:]].(type) {
+			case []map[string]any:
+				for _, child := range v {
+					children[j] = append(children[j], child)
+					childParents[j] = append(childParents[j], i+2)
+				}
+			case map[string]any:
+				if v != nil {
+					children[j] = append(children[j], v)
+					childParents[j] = append(childParents[j], i+2)
+				}
+			}
+		}
+	}
+	for j, key := range nested {
+		addQueryMapSheet(c, wb, sheet.Name+"."+key, root, info.Nested[key].ModelInfo, append(slices.Clip(path), key), children[j], sheet, childParents[j])
+	}
+}
+
+// xlsxColumns returns the columns of the sheet of the relation at path in the order of sel, like the CSV export
+func xlsxColumns(root, info *query.ModelInfo, path []string) []query.Column {
+	if len(root.Columns) == 0 {
+		return csvColumns(info)
+	}
+	columns := []query.Column{}
+	for _, column := range root.Columns {
+		if slices.Equal(column.Nested, path) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// sortedNested returns the keys of the nested relations in a stable order
+func sortedNested(info *query.ModelInfo) []string {
+	keys := make([]string, 0, len(info.Nested))
+	for key := range info.Nested {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/*
+DataWorkbook converts a struct or a slice of structs to a workbook, with a column for every exported field.
+Nested structs and slices of structs are written in their own sheets, whose first column is the row of the parent.
+*/
+func DataWorkbook(c *gin.Context, data any) *xlsx.Workbook {
+	wb := xlsx.NewWorkbook()
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if !v.IsValid() {
+		wb.AddSheet("Sheet")
+		return wb
+	}
+	items := []reflect.Value{}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, v.Index(i))
+		}
+	} else {
+		items = append(items, v)
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		if t.Kind() == reflect.Interface {
+			if len(items) == 0 {
+				return wb
+			}
+			t = reflect.Indirect(items[0].Elem()).Type()
+			break
+		}
+		t = t.Elem()
+	}
+	addStructSheet(c, wb, t.Name(), t, items, nil, nil)
+	return wb
+}
+
+func addStructSheet(c *gin.Context, wb *xlsx.Workbook, name string, t reflect.Type, items []reflect.Value, parent *xlsx.Sheet, parentRows []int) {
+	sheet := wb.AddSheet(name)
+	heading := []any{}
+	if parent != nil {
+		heading = append(heading, message.GetPrinter(c).Sprintf("Riga %s", parent.Name))
+	}
+	columns, relations := []reflect.StructField{}, []reflect.StructField{}
+	if t.Kind() == reflect.Struct {
+		for _, f := range reflect.VisibleFields(t) {
+			if f.Anonymous || !f.IsExported() || f.Tag.Get("json") == "-" {
+				continue
+			}
+			if isStructRelation(f.Type) {
+				relations = append(relations, f)
+				continue
+			}
+			columns = append(columns, f)
+			if label := f.Tag.Get("label"); label != "" {
+				heading = append(heading, label)
+			} else {
+				heading = append(heading, utils.SentenceCase(strings.ReplaceAll(f.Name, "_", " ")))
+			}
+		}
+	}
+	sheet.AddRow(heading...)
+
+	children := make([][]reflect.Value, len(relations))
+	childParents := make([][]int, len(relations))
+	for i, item := range items {
+		for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		values := make([]any, 0, len(heading))
+		if parent != nil {
+			values = append(values, parentRows[i])
+		}
+		if item.Kind() != reflect.Struct {
+			sheet.AddRow(append(values, xlsxValue(c, item.Interface()))...)
+			continue
+		}
+		for _, f := range columns {
+			if fv, err := item.FieldByIndexErr(f.Index); err == nil {
+				values = append(values, xlsxValue(c, fv.Interface()))
+			} else {
+				values = append(values, nil)
+			}
+		}
+		sheet.AddRow(values...)
+
+		for j, f := range relations {
+			fv, err := item.FieldByIndexErr(f.Index)
+			if err != nil {
+				continue
+			}
+			fv = reflect.Indirect(fv)
+			if fv.Kind() == reflect.Slice {
+				for k := 0; k < fv.Len(); k++ {
+					children[j] = append(children[j], fv.Index(k))
+					childParents[j] = append(childParents[j], i+2)
+				}
+			} else if fv.IsValid() && !fv.IsZero() {
+				children[j] = append(children[j], fv)
+				childParents[j] = append(childParents[j], i+2)
+			}
+		}
+	}
+	for j, f := range relations {
+		elem := f.Type
+		for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Slice {
+			elem = elem.Elem()
+		}
+		addStructSheet(c, wb, sheet.Name+"."+f.Name, elem, children[j], sheet, childParents[j])
+	}
+}
+
+// isStructRelation reports whether the field contains other records, as a struct or a slice of structs
+func isStructRelation(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.ConvertibleTo(reflect.TypeOf(time.Time{})) {
+		return false
+	}
+	return !reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem())
+}
+
+// xlsxValue converts a value to one with a cell type, dates without time are written as such and datetimes in the timezone of the request
+func xlsxValue(c *gin.Context, val any) any {
+	rv := reflect.ValueOf(val)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	switch v := rv.Interface().(type) {
+	case datatypes.Date:
+		return xlsx.Date(time.Time(v))
+	case datatypes.Datetime:
+		t := time.Time(v)
+		if tmz := c.GetHeader("Timezone"); tmz != "" {
+			if loc, err := time.LoadLocation(tmz); err == nil {
+				t = t.In(loc)
+			}
+		}
+		return t
+	case json.RawMessage:
+		return string(v)
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		if rv.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+			return rv.Interface()
+		}
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+		data, _ := json.Marshal(rv.Interface())
+		return string(data)
+	}
+	return rv.Interface()
+}
@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"api_core/datatypes"
+	"api_core/model"
+	"api_core/query"
+
+	"github.com/gin-gonic/gin"
+)
+
+// XMLRootName is the default name of the element containing the list of records, the records are named after their model
+var XMLRootName = "Data"
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+func encodeXML(c *gin.Context, p Payload) error {
+	if p.Args == nil {
+		// Data without a named type, nil included, is wrapped to have a root element
+		if p.Data == nil || reflect.TypeOf(p.Data).Name() == "" || len(c.Query("wrap")) > 0 {
+			c.XML(http.StatusOK, p.Wrapped())
+		} else {
+			c.XML(http.StatusOK, p.Data)
+		}
+		return nil
+	}
+
+	contentType, _ := NegotiateEncoder(c)
+	c.Header("Content-Type", contentType+"; charset=utf-8")
+	c.Status(http.StatusOK)
+	if _, err := c.Writer.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(c.Writer)
+	if err := encodeXMLQueryResult(c, enc, p); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+/*
+encodeXMLQueryResult writes the rows of a query as elements named after the model, or as configured by model.XMLModel, containing an element for each field.
+The nested relations are child elements, containing an element for each record when they are lists. Null values are marked with xsi:nil.
+*/
+func encodeXMLQueryResult(c *gin.Context, enc *xml.Encoder, p Payload) error {
+	info := &p.Args.Info
+	root, item := XMLRootName, info.Schema.Name
+	if xmlMdl, ok := reflect.New(info.Schema.ModelType).Interface().(model.XMLModel); ok {
+		root, item = xmlMdl.XMLNames()
+	}
+	nsAttr := xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace}
+
+	wrap := len(c.Query("wrap")) > 0
+	if wrap {
+		if err := enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Response"}, Attr: []xml.Attr{nsAttr}}); err != nil {
+			return err
+		}
+		root = "Data"
+	}
+
+	if len(p.Args.Primaries) != 0 {
+		start := xml.StartElement{Name: xml.Name{Local: xmlName(item)}}
+		if !wrap {
+			start.Attr = []xml.Attr{nsAttr}
+		}
+		if err := encodeXMLRow(c, enc, start, info, p.Args.Result[0]); err != nil {
+			return err
+		}
+	} else {
+		start := xml.StartElement{Name: xml.Name{Local: xmlName(root)}}
+		if !wrap {
+			start.Attr = []xml.Attr{nsAttr}
+		}
+		if err := encodeXMLRows(c, enc, start, xmlName(item), info, p.Args.Result); err != nil {
+			return err
+		}
+	}
+
+	if wrap {
+		if err := encodeXMLValue(c, enc, "Next", p.Links.Next); err != nil {
+			return err
+		}
+		for _, link := range []struct{ name, url string }{{"Prev", p.Links.Prev}, {"First", p.Links.First}, {"Last", p.Links.Last}} {
+			if link.url != "" {
+				if err := encodeXMLValue(c, enc, link.name, link.url); err != nil {
+					return err
+				}
+			}
+		}
+		if err := encodeXMLValue(c, enc, "Count", p.Count); err != nil {
+			return err
+		}
+		if p.NextCursor != "" {
+			if err := encodeXMLValue(c, enc, "NextCursor", p.NextCursor); err != nil {
+				return err
+			}
+		}
+		if p.PrevCursor != "" {
+			if err := encodeXMLValue(c, enc, "PrevCursor", p.PrevCursor); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "Response"}})
+	}
+	return nil
+}
+
+func encodeXMLRows(c *gin.Context, enc *xml.Encoder, start xml.StartElement, item string, info *query.ModelInfo, rows []map[string]any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := encodeXMLRow(c, enc, xml.StartElement{Name: xml.Name{Local: item}}, info, row); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// encodeXMLRow writes the fields in the order of sel, followed by the computed fields and the nested relations
+func encodeXMLRow(c *gin.Context, enc *xml.Encoder, start xml.StartElement, info *query.ModelInfo, row map[string]any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	written := map[string]struct{}{}
+	for _, f := range info.OutputFields() {
+		if _, ok := written[f.Name]; ok {
+			continue
+		}
+		written[f.Name] = struct{}{}
+		if err := encodeXMLValue(c, enc, f.Name, row[f.Name]); err != nil {
+			return err
+		}
+	}
+
+	nested := map[string]query.NestedModel{}
+	for key, rel := range info.Nested {
+		nested[key[strings.LastIndex(key, ".")+1:]] = rel
+	}
+	others := []string{}
+	for key := range row {
+		if _, ok := written[key]; !ok {
+			if _, ok := nested[key]; !ok {
+				others = append(others, key)
+			}
+		}
+	}
+	sort.Strings(others)
+	for _, key := range others {
+		if err := encodeXMLValue(c, enc, key, row[key]); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range sortedNested(info) {
+		name := key[strings.LastIndex(key, ".")+1:]
+		rel := info.Nested[key]
+		relStart := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+		switch v := row[name].(type) {
+		case []map[string]any:
+			if err := encodeXMLRows(c, enc, relStart, xmlName(rel.ModelInfo.Schema.Name), rel.ModelInfo, v); err != nil {
+				return err
+			}
+		case map[string]any:
+			if v == nil {
+				if err := encodeXMLValue(c, enc, name, nil); err != nil {
+					return err
+				}
+			} else if err := encodeXMLRow(c, enc, relStart, rel.ModelInfo, v); err != nil {
+				return err
+			}
+		default:
+			if err := encodeXMLValue(c, enc, name, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// encodeXMLValue writes a value in the lexical form of its XML Schema type
+func encodeXMLValue(c *gin.Context, enc *xml.Encoder, name string, val any) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	text, ok := xmlText(c, val)
+	if !ok {
+		start.Attr = []xml.Attr{{Name: xml.Name{Local: "xsi:nil"}, Value: "true"}}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		return enc.EncodeToken(start.End())
+	}
+	return enc.EncodeElement(text, start)
+}
+
+func xmlText(c *gin.Context, val any) (string, bool) {
+	rv := reflect.ValueOf(val)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "", false
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return "", false
+	}
+	switch v := rv.Interface().(type) {
+	case datatypes.Date:
+		return time.Time(v).Format("2006-01-02"), true
+	case datatypes.Datetime:
+		return xmlDatetime(c, time.Time(v)), true
+	case time.Time:
+		return xmlDatetime(c, v), true
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), true
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), true
+	case reflect.String:
+		return rv.String(), true
+	}
+	text, err := xmlMarshalText(rv.Interface())
+	return text, err == nil
+}
+
+func xmlDatetime(c *gin.Context, t time.Time) string {
+	if tmz := c.GetHeader("Timezone"); tmz != "" {
+		if loc, err := time.LoadLocation(tmz); err == nil {
+			t = t.In(loc)
+		}
+	}
+	return t.Format(time.RFC3339)
+}
+
+// xmlMarshalText converts the other values with their text or JSON representation
+func xmlMarshalText(val any) (string, error) {
+	if marshaler, ok := val.(interface{ MarshalText() ([]byte, error) }); ok {
+		data, err := marshaler.MarshalText()
+		return string(data), err
+	}
+	data, err := json.Marshal(val)
+	return string(data), err
+}
+
+// xmlName makes the name a valid element name
+func xmlName(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' {
+			runes[i] = '_'
+		}
+	}
+	if len(runes) == 0 || (!unicode.IsLetter(runes[0]) && runes[0] != '_') {
+		runes = append([]rune{'_'}, runes...)
+	}
+	return string(runes)
+}
@@ -1,10 +1,11 @@
 package datamanager
 
 import (
-	"log"
 	"os"
 	"time"
 
+	"api_core/app"
+
 	"github.com/go-gormigrate/gormigrate/v2"
 	"gorm.io/gorm"
 )
@@ -23,57 +24,61 @@ type DataManager struct {
 }
 
 func (dm DataManager) BeforeMigrate(db *gorm.DB) error {
+	log := app.LoggerFrom(db.Statement.Context)
 	if len(dm.Before) > 0 {
 		start := time.Now()
-		log.Printf("BeforeMigrate start\n")
+		log.Info("BeforeMigrate start")
 		m := gormigrate.New(db, dm.Options, dm.Before)
 		if err := m.Migrate(); err != nil {
-			log.Printf("BeforeMigrate error %v\n", err)
+			log.Error("BeforeMigrate failed", "error", err)
 			return err
 		}
-		log.Printf("BeforeMigrate done in %v\n", time.Since(start))
+		log.Info("BeforeMigrate done", "elapsed", time.Since(start))
 	}
 	return nil
 }
 
 func (dm DataManager) Migrate(db *gorm.DB) error {
+	log := app.LoggerFrom(db.Statement.Context)
 	start := time.Now()
-	log.Printf("Migrate start\n")
+	log.Info("Migrate start")
 	err := db.AutoMigrate(dm.Models...)
 	if err != nil {
-		log.Printf("Migrate error %v\n", err)
+		log.Error("Migrate failed", "error", err)
 		return err
 	}
-	log.Printf("Migrate done in %v\n", time.Since(start))
+	log.Info("Migrate done", "elapsed", time.Since(start))
 	return nil
 }
 
 func (dm DataManager) AfterMigrate(db *gorm.DB) error {
+	log := app.LoggerFrom(db.Statement.Context)
 	if len(dm.After) > 0 {
 		start := time.Now()
-		log.Printf("AfterMigrate start\n")
+		log.Info("AfterMigrate start")
 		m := gormigrate.New(db, dm.Options, dm.After)
 		if err := m.Migrate(); err != nil {
-			log.Printf("AfterMigrate error %v\n", err)
+			log.Error("AfterMigrate failed", "error", err)
 			return err
 		}
-		log.Printf("AfterMigrate done in %v\n", time.Since(start))
+		log.Info("AfterMigrate done", "elapsed", time.Since(start))
 	}
 	return nil
 }
 
 func (dm DataManager) SkipAfter(db *gorm.DB, ID string) {
+	log := app.LoggerFrom(db.Statement.Context)
 	// TODO: Skip the 'before' when the DB has been created 100% by the APIs
 	if len(ID) > 0 {
 		for _, mod := range dm.After {
 			if mod.ID == ID {
-				log.Println("ID: " + mod.ID)
+				log.Info("Skipping migration", "id", mod.ID)
 				db.Exec(`INSERT INTO `+dm.Options.TableName+` (id) VALUES(?)`, mod.ID)
 			}
 		}
 	} else {
 		for _, mod := range dm.After {
-			log.Printf(mod.ID)
+			log.Info("Skipping migration", "id", mod.ID)
 			db.Exec(`INSERT INTO `+dm.Options.TableName+` (id) VALUES(?)`, mod.ID)
 		}
 	}
@@ -91,7 +96,7 @@ func (dm DataManager) Seed(db *gorm.DB, ids []string) {
 
 func (dm DataManager) Apply(db *gorm.DB) {
 	if os.Getenv("ENV_TYPE") == "DEVELOPMENT" {
-		log.Println("Skipping the migrations because the ENV_TYPE is set to DEVELOPMENT")
+		app.LoggerFrom(db.Statement.Context).Info("Skipping the migrations because the ENV_TYPE is set to DEVELOPMENT")
 		return
 	}
 	err := dm.BeforeMigrate(db)
@@ -0,0 +1,199 @@
+package message
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Codes of the messages, they don't change across versions and languages
+const (
+	CodeOk                                    = "ok"
+	CodeItemFound                             = "item_found"
+	CodeBadRequest                            = "bad_request"
+	CodeInvalidUrlParameter                   = "invalid_url_parameter"
+	CodeForbidden                             = "forbidden"
+	CodeInsufficientPermissions               = "insufficient_permissions"
+	CodeInsufficientPermissionsHasOne         = "insufficient_permissions_has_one"
+	CodeUnauthorizedRelations                 = "unauthorized_relations"
+	CodeUnauthorizedModel                     = "unauthorized_model"
+	CodeUnauthorizedFields                    = "unauthorized_fields"
+	CodeReadOnlyFields                        = "read_only_fields"
+	CodeItemNotFound                          = "item_not_found"
+	CodeFileNotFound                          = "file_not_found"
+	CodeFolderNotFound                        = "folder_not_found"
+	CodeRouteNotFound                         = "route_not_found"
+	CodeConflict                              = "conflict"
+	CodeDeleteFailed                          = "delete_failed"
+	CodeDuplicateUnique                       = "duplicate_unique"
+	CodeCannotDeleteSharedResource            = "cannot_delete_shared_resource"
+	CodeConflictingPaginationAndAggregation   = "conflicting_pagination_and_aggregation"
+	CodeConflictingOrderByAndDistinct         = "conflicting_order_by_and_distinct"
+	CodeConflictingUsername                   = "conflicting_username"
+	CodeIdempotencyKeyReused                  = "idempotency_key_reused"
+	CodeIdempotencyKeyInProgress              = "idempotency_key_in_progress"
+	CodeManualPagination                      = "manual_pagination"
+	CodeMissingRequiredParameter              = "missing_required_parameter"
+	CodeMissingRequiredParameterForQueryField = "missing_required_parameter_for_query_field"
+	CodeMissingForeignKey                     = "missing_foreign_key"
+	CodeCannotCreatePrint                     = "cannot_create_print"
+	CodeMissingBaseResourceSelect             = "missing_base_resource_select"
+	CodePreconditionFailed                    = "precondition_failed"
+	CodeUnprocessable                         = "unprocessable"
+	CodeInvalidJSON                           = "invalid_json"
+	CodeInvalidParamsJSON                     = "invalid_params_json"
+	CodeInvalidParamsSyntax                   = "invalid_params_syntax"
+	CodeInvalidField                          = "invalid_field"
+	CodeInvalidFieldValue                     = "invalid_field_value"
+	CodeInvalidFieldAlias                     = "invalid_field_alias"
+	CodeInvalidParamOperator                  = "invalid_param_operator"
+	CodeInvalidParamType                      = "invalid_param_type"
+	CodeMany2ManyCreateNotAllowed             = "many2many_create_not_allowed"
+	CodeInvalidRelation                       = "invalid_relation"
+	CodeInvalidRelations                      = "invalid_relations"
+	CodeInvalidOrders                         = "invalid_orders"
+	CodeInvalidReference                      = "invalid_reference"
+	CodeDuplicateStructField                  = "duplicate_struct_field"
+	CodeInvalidFieldRequired                  = "invalid_field_required"
+	CodeRowError                              = "row_error"
+	CodeDisplayNameNotSupported               = "display_name_not_supported"
+	CodeInternalServerError                   = "internal_server_error"
+	CodeExpectedSlice                         = "expected_slice"
+	CodeUnsupportedParamType                  = "unsupported_param_type"
+	CodeValidationFailed                      = "validation_failed"
+	CodeDuplicateValues                       = "duplicate_values"
+)
+
+// placeholderRow replaces the number of the row in the template of RowError, it's below 1000 to be printed without separators
+const placeholderRow = 987
+
+/*
+samples build each message with placeholders in the form {name} as parameters, named as the properties of the message.
+They produce the templates listed by Codes.
+*/
+var samples = map[string]func(c *gin.Context) Message{
+	CodeOk:                                    func(c *gin.Context) Message { return Ok(c) },
+	CodeItemFound:                             func(c *gin.Context) Message { return ItemFound(c) },
+	CodeBadRequest:                            func(c *gin.Context) Message { return BadRequest(c) },
+	CodeInvalidUrlParameter:                   func(c *gin.Context) Message { return InvalidUrlParameter(c, "{parameter}") },
+	CodeForbidden:                             func(c *gin.Context) Message { return Forbidden(c) },
+	CodeInsufficientPermissions:               func(c *gin.Context) Message { return InsufficientPermissions(c, "{permissions}") },
+	CodeInsufficientPermissionsHasOne:         func(c *gin.Context) Message { return InsufficientPermissionsHasOne(c, "{permissions}") },
+	CodeUnauthorizedRelations:                 func(c *gin.Context) Message { return UnauthorizedRelations(c, "{relations}") },
+	CodeUnauthorizedModel:                     func(c *gin.Context) Message { return UnathorizedModel(c, "{model}") },
+	CodeUnauthorizedFields:                    func(c *gin.Context) Message { return UnauthorizedFields(c, "{fields}") },
+	CodeReadOnlyFields:                        func(c *gin.Context) Message { return ReadOnlyFields(c, "{fields}") },
+	CodeItemNotFound:                          func(c *gin.Context) Message { return ItemNotFound(c) },
+	CodeFileNotFound:                          func(c *gin.Context) Message { return FileNotFound(c) },
+	CodeFolderNotFound:                        func(c *gin.Context) Message { return FolderNotFound(c) },
+	CodeRouteNotFound:                         func(c *gin.Context) Message { return RouteNotFound(c, "{method}", "{path}") },
+	CodeConflict:                              func(c *gin.Context) Message { return Conflict(c) },
+	CodeDeleteFailed:                          func(c *gin.Context) Message { return DeleteFailed(c, []string{"{relations}"}) },
+	CodeDuplicateUnique:                       func(c *gin.Context) Message { return DuplicateUnique(c, "{table}", "{combination}") },
+	CodeCannotDeleteSharedResource:            func(c *gin.Context) Message { return CannotDeleteSharedResource(c) },
+	CodeConflictingPaginationAndAggregation:   func(c *gin.Context) Message { return ConflictingPaginationAndAggregation(c) },
+	CodeConflictingOrderByAndDistinct:         func(c *gin.Context) Message { return ConflictingOrderByAndDistinct(c) },
+	CodeConflictingUsername:                   func(c *gin.Context) Message { return ConflictingUsername(c) },
+	CodeIdempotencyKeyReused:                  func(c *gin.Context) Message { return IdempotencyKeyReused(c) },
+	CodeIdempotencyKeyInProgress:              func(c *gin.Context) Message { return IdempotencyKeyInProgress(c) },
+	CodeManualPagination:                      func(c *gin.Context) Message { return ManualPagination(c) },
+	CodeMissingRequiredParameter:              func(c *gin.Context) Message { return MissingRequiredParameter(c, "{name}", "{in}") },
+	CodeMissingRequiredParameterForQueryField: func(c *gin.Context) Message { return MissingRequiredParameterForQueryField(c, "{name}", "{field}") },
+	CodeMissingForeignKey:                     func(c *gin.Context) Message { return MissingForeignKey(c, "{key}", "{relation}") },
+	CodeCannotCreatePrint:                     func(c *gin.Context) Message { return CannotCreatePrint(c) },
+	CodeMissingBaseResourceSelect:             func(c *gin.Context) Message { return MissingBaseResourceSelect(c, "{resource}") },
+	CodePreconditionFailed:                    func(c *gin.Context) Message { return PreconditionFailed(c) },
+	CodeUnprocessable:                         func(c *gin.Context) Message { return Unprocessable(c) },
+	CodeInvalidJSON:                           func(c *gin.Context) Message { return InvalidJSON(c) },
+	CodeInvalidParamsJSON:                     func(c *gin.Context) Message { return InvalidParamsJSON(c) },
+	CodeInvalidParamsSyntax:                   func(c *gin.Context) Message { return InvalidParamsSyntax(c) },
+	CodeInvalidField:                          func(c *gin.Context) Message { return InvalidField(c, "{field}") },
+	CodeInvalidFieldValue:                     func(c *gin.Context) Message { return InvalidFieldValue(c, "{field}", "{rules}", "{value}") },
+	CodeInvalidFieldAlias:                     func(c *gin.Context) Message { return InvalidFieldAlias(c, "{alias}", "{field}") },
+	CodeInvalidParamOperator:                  func(c *gin.Context) Message { return InvalidParamOperator(c, "{operator}") },
+	CodeInvalidParamType:                      func(c *gin.Context) Message { return InvalidParamType(c, "{field}", "{expectedType}") },
+	CodeMany2ManyCreateNotAllowed:             func(c *gin.Context) Message { return Many2ManyCreateNotAllowed(c, "{relation}") },
+	CodeInvalidRelation:                       func(c *gin.Context) Message { return InvalidRelation(c, "{relation}") },
+	CodeInvalidRelations:                      func(c *gin.Context) Message { return InvalidRelations(c, "{relations}") },
+	CodeInvalidOrders:                         func(c *gin.Context) Message { return InvalidOrders(c, "{orders}") },
+	CodeInvalidReference:                      func(c *gin.Context) Message { return InvalidReference(c, "{reference}") },
+	CodeDuplicateStructField:                  func(c *gin.Context) Message { return DuplicateStructField(c, "{field}") },
+	CodeInvalidFieldRequired:                  func(c *gin.Context) Message { return InvalidFieldRequired(c, "{field}") },
+	CodeRowError: func(c *gin.Context) Message {
+		msg := RowError(c, placeholderRow, "{error}").(*Msg)
+		msg.Message = strings.Replace(msg.Message, strconv.Itoa(placeholderRow), "{row}", 1)
+		return msg
+	},
+	CodeDisplayNameNotSupported: func(c *gin.Context) Message { return DisplayNameNotSupported(c) },
+	CodeInternalServerError:     func(c *gin.Context) Message { return InternalServerError(c) },
+	CodeExpectedSlice:           func(c *gin.Context) Message { return ExpectedSlice(c) },
+	CodeUnsupportedParamType:    func(c *gin.Context) Message { return UnsupportedParamType(c, "{parameter}") },
+	CodeValidationFailed:        func(c *gin.Context) Message { return ValidationFailed(c) },
+	CodeDuplicateValues:         func(c *gin.Context) Message { return DuplicateValues(c) },
+}
+
+// CodeInfo describes a message code, with its template in every language
+type CodeInfo struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	// Params are the properties of the message, used as {name} placeholders in the templates
+	Params    []string          `json:"params"`
+	Templates map[string]string `json:"templates"`
+}
+
+// RegisterCode adds a message code to the ones listed by Codes, sample builds the message with a {name} placeholder for every parameter
+func RegisterCode(code string, sample func(c *gin.Context) Message) {
+	samples[code] = sample
+}
+
+// Languages returns the languages of the translations, along with the Italian of the source messages
+func Languages() []language.Tag {
+	tags := message.DefaultCatalog.Languages()
+	for _, tag := range tags {
+		if tag == language.Italian {
+			return tags
+		}
+	}
+	return append([]language.Tag{language.Italian}, tags...)
+}
+
+// Codes lists the registered message codes sorted by code, with their templates in every language
+func Codes() []CodeInfo {
+	codes := make([]string, 0, len(samples))
+	for code := range samples {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	languages := Languages()
+	contexts := make([]*gin.Context, len(languages))
+	for i, tag := range languages {
+		contexts[i] = &gin.Context{}
+		contexts[i].Set("i18n", message.NewPrinter(tag))
+	}
+
+	infos := make([]CodeInfo, len(codes))
+	for i, code := range codes {
+		info := CodeInfo{Code: code, Params: []string{}, Templates: map[string]string{}}
+		for j, tag := range languages {
+			msg, ok := samples[code](contexts[j]).(*Msg)
+			if !ok {
+				continue
+			}
+			if j == 0 {
+				info.Status = msg.Status
+				for name := range msg.Properties {
+					info.Params = append(info.Params, name)
+				}
+				sort.Strings(info.Params)
+			}
+			info.Templates[tag.String()] = msg.Message
+		}
+		infos[i] = info
+	}
+	return infos
+}
@@ -2,6 +2,9 @@ package message
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/text/language"
@@ -25,11 +28,21 @@ type Message interface {
 }
 
 type Msg struct {
-	Message    string
-	Status     int
+	Message string
+	Status  int
+	// Code identifies the message regardless of the language of its text
+	Code       string
 	Properties map[string]interface{}
 }
 
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails makes every error response use the RFC 7807 format, otherwise it's used only when requested with the Accept header
+var ProblemDetails = false
+
+// ProblemTypeBase is the URI prefix of the type of the problems, followed by their code. When empty the type is about:blank
+var ProblemTypeBase = ""
+
 func (m *Msg) Text(text string) Message {
 	m.Message = text
 	return m
@@ -37,6 +50,9 @@ func (m *Msg) Text(text string) Message {
 
 func (m *Msg) ToMap() map[string]interface{} {
 	mp := gin.H{"message": m.Message}
+	if m.Code != "" {
+		mp["code"] = m.Code
+	}
 	if m.Properties != nil {
 		for k, v := range m.Properties {
 			mp[k] = v
@@ -50,12 +66,48 @@ func (m *Msg) ToJSON() []byte {
 	return val
 }
 
+/*
+ToProblem returns the message as RFC 7807 problem details, the code and the properties are added as extensions.
+The type is ProblemTypeBase followed by the code, the title is the text of the status and the detail is the localized message.
+*/
+func (m *Msg) ToProblem(c *gin.Context) map[string]interface{} {
+	mp := gin.H{}
+	for k, v := range m.Properties {
+		mp[k] = v
+	}
+	mp["type"] = "about:blank"
+	if ProblemTypeBase != "" && m.Code != "" {
+		mp["type"] = ProblemTypeBase + m.Code
+	}
+	mp["title"] = http.StatusText(m.Status)
+	mp["status"] = m.Status
+	mp["detail"] = m.Message
+	if m.Code != "" {
+		mp["code"] = m.Code
+	}
+	if c != nil && c.Request != nil {
+		mp["instance"] = c.Request.URL.RequestURI()
+	}
+	return mp
+}
+
+// WantsProblem reports whether the errors of the request are written as problem details
+func WantsProblem(c *gin.Context) bool {
+	return ProblemDetails || strings.Contains(c.GetHeader("Accept"), ProblemContentType)
+}
+
 func (m *Msg) JSON(c *gin.Context) {
+	if m.IsError() && WantsProblem(c) {
+		c.Header("Content-Type", ProblemContentType)
+		c.JSON(m.Status, m.ToProblem(c))
+		return
+	}
 	c.JSON(m.Status, m.ToMap())
 }
 
 func (m *Msg) Abort(c *gin.Context) {
-	c.AbortWithStatusJSON(m.Status, m.ToMap())
+	c.Abort()
+	m.JSON(c)
 }
 
 func (m *Msg) Write(c *gin.Context) {
@@ -115,6 +167,29 @@ func GetPrinter(c *gin.Context) *message.Printer {
 	return message.NewPrinter(language.BritishEnglish)
 }
 
+// Translate returns the translation of a text that isn't a format, like the label of a field, without interpreting its % as verbs
+func Translate(c *gin.Context, text string) string {
+	return GetPrinter(c).Sprintf(message.Key(text, strings.ReplaceAll(text, "%", "%%")))
+}
+
+// AsMessage returns the message contained in err, also when it's wrapped
+func AsMessage(err error) (Message, bool) {
+	var msg Message
+	if errors.As(err, &msg) {
+		return msg, true
+	}
+	return nil, false
+}
+
+// WriteError writes the message contained in err, or an internal server error if err isn't a message
+func WriteError(c *gin.Context, err error) {
+	if msg, ok := AsMessage(err); ok {
+		msg.Write(c)
+		return
+	}
+	InternalServerError(c).Write(c)
+}
+
 func FromError(status int, err error) Message {
 	return &Msg{
 		Message: err.Error(),
@@ -14,6 +14,7 @@ func Ok(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Operazione eseguita con successo"),
 		Status:  http.StatusOK,
+		Code:    CodeOk,
 	}
 }
 
@@ -24,6 +25,7 @@ func ItemFound(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Elemento trovato"),
 		Status:  http.StatusTemporaryRedirect,
+		Code:    CodeItemFound,
 	}
 }
 
@@ -34,13 +36,16 @@ func BadRequest(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Richiesta non valida"),
 		Status:  http.StatusBadRequest,
+		Code:    CodeBadRequest,
 	}
 }
 
 func InvalidUrlParameter(c *gin.Context, parameter string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Il parametro in URL %s risulta mancante o non valido", parameter),
-		Status:  http.StatusBadRequest,
+		Message:    GetPrinter(c).Sprintf("Il parametro in URL %s risulta mancante o non valido", parameter),
+		Status:     http.StatusBadRequest,
+		Code:       CodeInvalidUrlParameter,
+		Properties: map[string]interface{}{"parameter": parameter},
 	}
 }
 
@@ -49,34 +54,61 @@ func Forbidden(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Accesso vietato"),
 		Status:  http.StatusForbidden,
+		Code:    CodeForbidden,
 	}
 }
 
 func InsufficientPermissions(c *gin.Context, permissions ...string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("I permessi %s sono richiesti per accedere a questa risorsa, per supporto contatta il tuo amministratore", strings.Join(permissions, ",")),
-		Status:  http.StatusForbidden,
+		Message:    GetPrinter(c).Sprintf("I permessi %s sono richiesti per accedere a questa risorsa, per supporto contatta il tuo amministratore", strings.Join(permissions, ",")),
+		Status:     http.StatusForbidden,
+		Code:       CodeInsufficientPermissions,
+		Properties: map[string]interface{}{"permissions": permissions},
 	}
 }
 
 func InsufficientPermissionsHasOne(c *gin.Context, permissions ...string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Almeno uno di questi permessi %s è richiesto per accedere a questa risorsa, per supporto contatta il tuo amministratore", strings.Join(permissions, ",")),
-		Status:  http.StatusForbidden,
+		Message:    GetPrinter(c).Sprintf("Almeno uno di questi permessi %s è richiesto per accedere a questa risorsa, per supporto contatta il tuo amministratore", strings.Join(permissions, ",")),
+		Status:     http.StatusForbidden,
+		Code:       CodeInsufficientPermissionsHasOne,
+		Properties: map[string]interface{}{"permissions": permissions},
 	}
 }
 
 func UnauthorizedRelations(c *gin.Context, relations ...string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Non hai autorizzazioni sufficienti per accedere alle seguenti relazioni: %s", strings.Join(relations, ",")),
-		Status:  http.StatusForbidden,
+		Message:    GetPrinter(c).Sprintf("Non hai autorizzazioni sufficienti per accedere alle seguenti relazioni: %s", strings.Join(relations, ",")),
+		Status:     http.StatusForbidden,
+		Code:       CodeUnauthorizedRelations,
+		Properties: map[string]interface{}{"relations": relations},
 	}
 }
 
 func UnathorizedModel(c *gin.Context, model string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Non puoi accedere al modello: %s", model),
-		Status:  http.StatusForbidden,
+		Message:    GetPrinter(c).Sprintf("Non puoi accedere al modello: %s", model),
+		Status:     http.StatusForbidden,
+		Code:       CodeUnauthorizedModel,
+		Properties: map[string]interface{}{"model": model},
+	}
+}
+
+func UnauthorizedFields(c *gin.Context, fields ...string) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("Non hai autorizzazioni sufficienti per accedere ai seguenti campi: %s", strings.Join(fields, ",")),
+		Status:     http.StatusForbidden,
+		Code:       CodeUnauthorizedFields,
+		Properties: map[string]interface{}{"fields": fields},
+	}
+}
+
+func ReadOnlyFields(c *gin.Context, fields ...string) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("Non hai autorizzazioni sufficienti per modificare i seguenti campi: %s", strings.Join(fields, ",")),
+		Status:     http.StatusForbidden,
+		Code:       CodeReadOnlyFields,
+		Properties: map[string]interface{}{"fields": fields},
 	}
 }
 
@@ -85,6 +117,7 @@ func ItemNotFound(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("La risorsa richiesta non è stata trovata"),
 		Status:  http.StatusNotFound,
+		Code:    CodeItemNotFound,
 	}
 }
 
@@ -92,6 +125,7 @@ func FileNotFound(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Il file richiesto non è stato trovato"),
 		Status:  http.StatusNotFound,
+		Code:    CodeFileNotFound,
 	}
 }
 
@@ -99,6 +133,16 @@ func FolderNotFound(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("La cartella richiesta non è stata trovata"),
 		Status:  http.StatusNotFound,
+		Code:    CodeFolderNotFound,
+	}
+}
+
+func RouteNotFound(c *gin.Context, method, path string) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("La rotta %s %s non è stata trovata", method, path),
+		Status:     http.StatusNotFound,
+		Code:       CodeRouteNotFound,
+		Properties: map[string]interface{}{"method": method, "path": path},
 	}
 }
 
@@ -107,20 +151,25 @@ func Conflict(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Conflict"),
 		Status:  http.StatusConflict,
+		Code:    CodeConflict,
 	}
 }
 
 func DeleteFailed(c *gin.Context, blockingRelations []string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Non è possibile eliminare la risorsa desiderata perché è utilizzata nelle seguenti relazioni.<br>%s", strings.Join(blockingRelations, "<br>")),
-		Status:  http.StatusConflict,
+		Message:    GetPrinter(c).Sprintf("Non è possibile eliminare la risorsa desiderata perché è utilizzata nelle seguenti relazioni.<br>%s", strings.Join(blockingRelations, "<br>")),
+		Status:     http.StatusConflict,
+		Code:       CodeDeleteFailed,
+		Properties: map[string]interface{}{"relations": blockingRelations},
 	}
 }
 
 func DuplicateUnique(c *gin.Context, table, combination string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("La combinazione %s esiste già per %s", combination, table),
-		Status:  http.StatusConflict,
+		Message:    GetPrinter(c).Sprintf("La combinazione %s esiste già per %s", combination, table),
+		Status:     http.StatusConflict,
+		Code:       CodeDuplicateUnique,
+		Properties: map[string]interface{}{"table": table, "combination": combination},
 	}
 }
 
@@ -129,6 +178,7 @@ func CannotDeleteSharedResource(c *gin.Context) Message {
 		Message: GetPrinter(c).Sprintf("Impossibile eliminare la risorsa condivisa poiché non ne sei il proprietario"),
 		// You cannot delete the shared resource because you are not the owner
 		Status: http.StatusConflict,
+		Code:   CodeCannotDeleteSharedResource,
 	}
 }
 
@@ -136,6 +186,7 @@ func ConflictingPaginationAndAggregation(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("La paginazione non è supportata con le aggregazioni"),
 		Status:  http.StatusConflict,
+		Code:    CodeConflictingPaginationAndAggregation,
 	}
 }
 
@@ -143,6 +194,7 @@ func ConflictingOrderByAndDistinct(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Il campo Ordine deve essere specificato nel campo Select quando si usa Distinct"),
 		Status:  http.StatusConflict,
+		Code:    CodeConflictingOrderByAndDistinct,
 	}
 }
 
@@ -150,6 +202,23 @@ func ConflictingUsername(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Username già registrato"),
 		Status:  http.StatusConflict,
+		Code:    CodeConflictingUsername,
+	}
+}
+
+func IdempotencyKeyReused(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("La chiave di idempotenza è già stata usata per una richiesta diversa"),
+		Status:  http.StatusConflict,
+		Code:    CodeIdempotencyKeyReused,
+	}
+}
+
+func IdempotencyKeyInProgress(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("Una richiesta con la stessa chiave di idempotenza è ancora in elaborazione"),
+		Status:  http.StatusConflict,
+		Code:    CodeIdempotencyKeyInProgress,
 	}
 }
 
@@ -157,27 +226,34 @@ func ManualPagination(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Per paginare la richiesta bisogna specificare l'attributo Order manualmente tramite il parametro in url 'ord'"),
 		Status:  http.StatusConflict,
+		Code:    CodeManualPagination,
 	}
 }
 
 func MissingRequiredParameter(c *gin.Context, name, in string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Parametro richiesto %s mancante in %s", name, in),
-		Status:  http.StatusConflict,
+		Message:    GetPrinter(c).Sprintf("Parametro richiesto %s mancante in %s", name, in),
+		Status:     http.StatusConflict,
+		Code:       CodeMissingRequiredParameter,
+		Properties: map[string]interface{}{"name": name, "in": in},
 	}
 }
 
 func MissingRequiredParameterForQueryField(c *gin.Context, name, field string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Parametro richiesto %s mancante nella query (es. &%s=3) per campo %s", name, field),
-		Status:  http.StatusConflict,
+		Message:    GetPrinter(c).Sprintf("Parametro richiesto %s mancante nella query (es. &%s=3) per campo %s", name, name, field),
+		Status:     http.StatusConflict,
+		Code:       CodeMissingRequiredParameterForQueryField,
+		Properties: map[string]interface{}{"name": name, "field": field},
 	}
 }
 
 func MissingForeignKey(c *gin.Context, key, rel string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Impossibile trovare la chiave esterna %s, richiesta dalla relazione %s, nell'oggetto padre.", key, rel),
-		Status:  http.StatusConflict,
+		Message:    GetPrinter(c).Sprintf("Impossibile trovare la chiave esterna %s, richiesta dalla relazione %s, nell'oggetto padre.", key, rel),
+		Status:     http.StatusConflict,
+		Code:       CodeMissingForeignKey,
+		Properties: map[string]interface{}{"key": key, "relation": rel},
 	}
 }
 
@@ -185,13 +261,25 @@ func CannotCreatePrint(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Impossibile stampare l'ordine del magazziniere quando l'ordine non è stato accettato."),
 		Status:  http.StatusConflict,
+		Code:    CodeCannotCreatePrint,
 	}
 }
 
 func MissingBaseResourceSelect(c *gin.Context, baseResource string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Seleziona almeno un elemento dalla risorsa base %s prima di accedere alle releazioni nidificate.", baseResource),
-		Status:  http.StatusConflict,
+		Message:    GetPrinter(c).Sprintf("Seleziona almeno un elemento dalla risorsa base %s prima di accedere alle releazioni nidificate.", baseResource),
+		Status:     http.StatusConflict,
+		Code:       CodeMissingBaseResourceSelect,
+		Properties: map[string]interface{}{"resource": baseResource},
+	}
+}
+
+// 412
+func PreconditionFailed(c *gin.Context) Message {
+	return &Msg{
+		Message: GetPrinter(c).Sprintf("La risorsa è stata modificata da un'altra richiesta, ricarica i dati e riprova"),
+		Status:  http.StatusPreconditionFailed,
+		Code:    CodePreconditionFailed,
 	}
 }
 
@@ -200,6 +288,7 @@ func Unprocessable(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("La richiesta inviata contiene dati non validi o incompleti"),
 		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeUnprocessable,
 	}
 }
 
@@ -207,6 +296,7 @@ func InvalidJSON(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("JSON mancante o non valido"),
 		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeInvalidJSON,
 	}
 }
 
@@ -214,6 +304,7 @@ func InvalidParamsJSON(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Il JSON dei parametri specificato non è sintatticamente corretto"),
 		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeInvalidParamsJSON,
 	}
 }
 
@@ -221,83 +312,124 @@ func InvalidParamsSyntax(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("La richiesta non è potuta essere completata per via di una sintassi dei parametri errata"),
 		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeInvalidParamsSyntax,
 	}
 }
 
 func InvalidField(c *gin.Context, field string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Il campo %s da voi richiesto non è stato trovato", field),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Il campo %s da voi richiesto non è stato trovato", field),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidField,
+		Properties: map[string]interface{}{"field": field},
 	}
 }
 
 func InvalidFieldValue(c *gin.Context, field, rules string, value interface{}) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Il valore %v specificato per il campo %s deve rispettare queste condizioni %s", value, field, rules),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Il valore %v specificato per il campo %s deve rispettare queste condizioni %s", value, field, rules),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidFieldValue,
+		Properties: map[string]interface{}{"field": field, "rules": rules, "value": value},
 	}
 }
 
 func InvalidFieldAlias(c *gin.Context, alias, field string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("L'alias %s, specificato per il campo %s, non è valido", alias, field),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("L'alias %s, specificato per il campo %s, non è valido", alias, field),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidFieldAlias,
+		Properties: map[string]interface{}{"alias": alias, "field": field},
 	}
 }
 
 func InvalidParamOperator(c *gin.Context, operator string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("L'operatore di parametro %s non è supportato", operator),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("L'operatore di parametro %s non è supportato", operator),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidParamOperator,
+		Properties: map[string]interface{}{"operator": operator},
 	}
 }
 
 func InvalidParamType(c *gin.Context, field string, correctType string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Il campo \"%s\" deve essere del tipo \"%s\"", field, correctType),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Il campo \"%s\" deve essere del tipo \"%s\"", field, correctType),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidParamType,
+		Properties: map[string]interface{}{"field": field, "expectedType": correctType},
+	}
+}
+
+func Many2ManyCreateNotAllowed(c *gin.Context, relation string) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("La relazione %s accetta solo collegamenti a record esistenti", relation),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeMany2ManyCreateNotAllowed,
+		Properties: map[string]interface{}{"relation": relation},
 	}
 }
 
 func InvalidRelation(c *gin.Context, table string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("La relazione %s non è stata trovata", table),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("La relazione %s non è stata trovata", table),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidRelation,
+		Properties: map[string]interface{}{"relation": table},
 	}
 }
 
 func InvalidRelations(c *gin.Context, relations ...string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Non è stato possibile completare la richiesta per via delle seguenti relazioni non valide specificate: %s", strings.Join(relations, ",")),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Non è stato possibile completare la richiesta per via delle seguenti relazioni non valide specificate: %s", strings.Join(relations, ",")),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidRelations,
+		Properties: map[string]interface{}{"relations": relations},
 	}
 }
 
 func InvalidOrders(c *gin.Context, orders ...string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Non è stato possibile completare la richiesta per via dei seguenti ordinamenti non validi specificati: %s", strings.Join(orders, ",")),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Non è stato possibile completare la richiesta per via dei seguenti ordinamenti non validi specificati: %s", strings.Join(orders, ",")),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidOrders,
+		Properties: map[string]interface{}{"orders": orders},
+	}
+}
+
+func InvalidReference(c *gin.Context, reference string) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("Il riferimento %s non corrisponde a nessun valore delle operazioni precedenti", reference),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidReference,
+		Properties: map[string]interface{}{"reference": reference},
 	}
 }
 
 func DuplicateStructField(c *gin.Context, field string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Campo %s duplicato nella struct, usare un alias per evitare questo errore (es. campo AS alias)", field),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Campo %s duplicato nella struct, usare un alias per evitare questo errore (es. campo AS alias)", field),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeDuplicateStructField,
+		Properties: map[string]interface{}{"field": field},
 	}
 }
 
 func InvalidFieldRequired(c *gin.Context, name string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("La proprietà %s è obbligatoria", name),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("La proprietà %s è obbligatoria", name),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeInvalidFieldRequired,
+		Properties: map[string]interface{}{"field": name},
 	}
 }
 
 func RowError(c *gin.Context, row int, message string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Riga %d:%s", row, message),
-		Status:  http.StatusUnprocessableEntity,
+		Message:    GetPrinter(c).Sprintf("Riga %d:%s", row, message),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeRowError,
+		Properties: map[string]interface{}{"row": row, "error": message},
 	}
 }
 
@@ -305,6 +437,7 @@ func DisplayNameNotSupported(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Questa risorsa non supporta DISPLAY_NAME"),
 		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeDisplayNameNotSupported,
 	}
 }
 
@@ -314,6 +447,7 @@ func InternalServerError(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Si è verificato un errore"),
 		Status:  http.StatusInternalServerError,
+		Code:    CodeInternalServerError,
 	}
 }
 
@@ -321,13 +455,16 @@ func ExpectedSlice(c *gin.Context) Message {
 	return &Msg{
 		Message: GetPrinter(c).Sprintf("Il parametro specificato non è del tipo *[]models.*"),
 		Status:  http.StatusInternalServerError,
+		Code:    CodeExpectedSlice,
 	}
 }
 
 func UnsupportedParamType(c *gin.Context, parameter string) Message {
 	return &Msg{
-		Message: GetPrinter(c).Sprintf("Il parametro specificato %s non è ancora supportato.", parameter),
-		Status:  http.StatusInternalServerError,
+		Message:    GetPrinter(c).Sprintf("Il parametro specificato %s non è ancora supportato.", parameter),
+		Status:     http.StatusInternalServerError,
+		Code:       CodeUnsupportedParamType,
+		Properties: map[string]interface{}{"parameter": parameter},
 	}
 }
 
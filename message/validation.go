@@ -0,0 +1,93 @@
+package message
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ValidationError describes a value of the request body failing a validation rule
+type ValidationError struct {
+	// Row is the index of the record in the body, 0 when a single record is sent
+	Row     int    `json:"row"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+// ValidationFailed lists the validation errors in the errors property of the response
+func ValidationFailed(c *gin.Context, errs ...ValidationError) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("La richiesta inviata contiene dati non validi o incompleti"),
+		Status:     http.StatusUnprocessableEntity,
+		Code:       CodeValidationFailed,
+		Properties: map[string]interface{}{"errors": errs},
+	}
+}
+
+// DuplicateValues lists the values already used by other records, or repeated in the request, for the unique fields
+func DuplicateValues(c *gin.Context, errs ...ValidationError) Message {
+	return &Msg{
+		Message:    GetPrinter(c).Sprintf("La richiesta contiene valori già utilizzati in campi che devono essere univoci"),
+		Status:     http.StatusConflict,
+		Code:       CodeDuplicateValues,
+		Properties: map[string]interface{}{"errors": errs},
+	}
+}
+
+// ValidationErrorsOf returns the validation errors of a message created by ValidationFailed, nil for any other error
+func ValidationErrorsOf(err error) []ValidationError {
+	var msg *Msg
+	if errors.As(err, &msg) {
+		if errs, ok := msg.Get("errors").([]ValidationError); ok {
+			return errs
+		}
+	}
+	return nil
+}
+
+// RuleText describes the validation rule failed by the field, identified by its label
+func RuleText(c *gin.Context, label, rule, param string) string {
+	p := GetPrinter(c)
+	switch rule {
+	case "required":
+		return p.Sprintf("Il campo %s è obbligatorio", label)
+	case "required_with":
+		return p.Sprintf("Il campo %s è obbligatorio quando è presente %s", label, param)
+	case "required_without":
+		return p.Sprintf("Il campo %s è obbligatorio quando non è presente %s", label, param)
+	case "max":
+		return p.Sprintf("Il campo %s deve essere al massimo %s", label, param)
+	case "min":
+		return p.Sprintf("Il campo %s deve essere almeno %s", label, param)
+	case "len":
+		return p.Sprintf("Il campo %s deve avere lunghezza %s", label, param)
+	case "gt":
+		return p.Sprintf("Il campo %s deve essere maggiore di %s", label, param)
+	case "gte":
+		return p.Sprintf("Il campo %s deve essere maggiore o uguale a %s", label, param)
+	case "lt":
+		return p.Sprintf("Il campo %s deve essere minore di %s", label, param)
+	case "lte":
+		return p.Sprintf("Il campo %s deve essere minore o uguale a %s", label, param)
+	case "oneof":
+		return p.Sprintf("Il campo %s deve essere uno dei seguenti valori: %s", label, param)
+	case "email":
+		return p.Sprintf("Il campo %s deve essere un indirizzo email valido", label)
+	case "url":
+		return p.Sprintf("Il campo %s deve essere un URL valido", label)
+	case "unknown":
+		return p.Sprintf("Il campo %s non esiste", label)
+	case "unique":
+		if param != "" {
+			return p.Sprintf("La combinazione dei campi %s e %s è già utilizzata", label, param)
+		}
+		return p.Sprintf("Il valore del campo %s è già utilizzato", label)
+	}
+	if param != "" {
+		return p.Sprintf("Il campo %s non rispetta la regola %s=%s", label, rule, param)
+	}
+	return p.Sprintf("Il campo %s non rispetta la regola %s", label, rule)
+}
@@ -56,6 +56,22 @@ type DisplayNamePatternModel interface {
 	DisplayNamePattern() string
 }
 
+// CacheControlModel declares the Cache-Control policy of the responses containing the model
+type CacheControlModel interface {
+	CacheControl(*gin.Context) string
+}
+
+// VersionedModel enables optimistic concurrency control, VersionField returns the name of a numeric field incremented on every update.
+// When it returns an empty string the version of a row is computed as a hash of all its columns.
+type VersionedModel interface {
+	VersionField() string
+}
+
+// XMLModel declares the names of the elements containing the list of records and each record in XML responses
+type XMLModel interface {
+	XMLNames() (root string, item string)
+}
+
 type tableField struct {
 	Table string
 	Field *schema.Field
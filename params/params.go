@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"api_core/message"
+	"api_core/permissions"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iancoleman/orderedmap"
@@ -59,3 +60,11 @@ func ToStmt(c *gin.Context, params, p string, modelSchema *schema.Schema, alias
 	}
 	return nil
 }
+
+// readableField returns an error when the field, also of a relation, can't be read in the request
+func readableField(c *gin.Context, modelSchema *schema.Schema, key string) message.Message {
+	if fieldSchema, field := permissions.LookUpField(modelSchema, key); field != nil && !permissions.CanRead(c, fieldSchema, field) {
+		return message.UnauthorizedFields(c, key)
+	}
+	return nil
+}
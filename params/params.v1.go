@@ -26,6 +26,9 @@ func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, param
 				if field, ok = rawField.(string); ok {
 					_, ok := allowed[field]
 					if allowed == nil || ok {
+						if msg := readableField(c, modelSchema, field); msg != nil {
+							return msg
+						}
 						if parsedField, args, found := parseField(c, modelSchema, alias, field, conds.Nested); found {
 							conds.Args = append(conds.Args, args...)
 							err := parseStructuredParam(c, parsedField, v, operator, conds)
@@ -48,6 +51,9 @@ func parseParams(c *gin.Context, modelSchema *schema.Schema, alias string, param
 				for field, value := range v {
 					_, ok := allowed[field]
 					if allowed == nil || ok {
+						if msg := readableField(c, modelSchema, field); msg != nil {
+							return msg
+						}
 						if parsedField, args, found := parseField(c, modelSchema, alias, field, conds.Nested); found {
 							conds.Args = append(conds.Args, args...)
 
@@ -121,6 +121,9 @@ func addLogicOperator(ops string, stmt *string) {
 }
 
 func addCondition(c *gin.Context, modelSchema *schema.Schema, alias, ops string, key string, value interface{}, conds *Conditions, relations map[string]*Conditions) message.Message {
+	if msg := readableField(c, modelSchema, key); msg != nil {
+		return msg
+	}
 	if field, args, typ := parseFieldV2(c, modelSchema, alias, key, relations); typ != nil {
 		conds.Query += " " + field
 		conds.Args = append(conds.Args, args...)
@@ -0,0 +1,69 @@
+package permissions
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/schema"
+)
+
+// FieldAccess is the access granted to a field of a model
+type FieldAccess int
+
+const (
+	FieldHidden FieldAccess = iota
+	FieldReadOnly
+	FieldReadWrite
+)
+
+/*
+ModelWithFieldPermissions restricts the access to the fields of the model in the session of the request.
+The fields missing from the returned map keep the access granted by the readPerm and writePerm tags.
+*/
+type ModelWithFieldPermissions interface {
+	FieldPermissions(c *gin.Context) map[string]FieldAccess
+}
+
+/*
+Field returns the access to the field of the schema for the request.
+The readPerm and writePerm tags list the permissions, separated by commas, of which at least one is required to read or write the field.
+A field that can't be read can't be written either.
+*/
+func Field(c *gin.Context, modelSchema *schema.Schema, field *schema.Field) FieldAccess {
+	access := FieldReadWrite
+	if keys, ok := field.Tag.Lookup("readPerm"); ok && !HasOne(strings.Split(keys, ",")...) {
+		access = FieldHidden
+	} else if keys, ok := field.Tag.Lookup("writePerm"); ok && !HasOne(strings.Split(keys, ",")...) {
+		access = FieldReadOnly
+	}
+	if mdl, ok := reflect.New(modelSchema.ModelType).Interface().(ModelWithFieldPermissions); ok {
+		if fieldAccess, ok := mdl.FieldPermissions(c)[field.Name]; ok && fieldAccess < access {
+			access = fieldAccess
+		}
+	}
+	return access
+}
+
+// CanRead reports whether the field can be selected, filtered and sorted in the request
+func CanRead(c *gin.Context, modelSchema *schema.Schema, field *schema.Field) bool {
+	return Field(c, modelSchema, field) >= FieldReadOnly
+}
+
+// CanWrite reports whether the field can be written in the request
+func CanWrite(c *gin.Context, modelSchema *schema.Schema, field *schema.Field) bool {
+	return Field(c, modelSchema, field) == FieldReadWrite
+}
+
+// LookUpField returns the field at the path, with the relations separated by dots, and the schema containing it
+func LookUpField(modelSchema *schema.Schema, path string) (*schema.Schema, *schema.Field) {
+	pieces := strings.Split(path, ".")
+	for _, piece := range pieces[:len(pieces)-1] {
+		rel, ok := modelSchema.Relationships.Relations[strings.TrimPrefix(piece, ">")]
+		if !ok {
+			return modelSchema, nil
+		}
+		modelSchema = rel.FieldSchema
+	}
+	return modelSchema, modelSchema.LookUpField(pieces[len(pieces)-1])
+}
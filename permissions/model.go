@@ -70,21 +70,28 @@ func Delete(model interface{}) HandlerFunc {
 }
 
 func CheckModel(c *gin.Context, modelVal reflect.Value, modelSchema *schema.Schema, cache map[string]struct{}, checkDelete bool) error {
-	for _, rel := range modelSchema.Relationships.HasMany {
-		relField := rel.Field.ReflectValueOf(context.Background(), modelVal)
-		if !relField.IsNil() {
+	// The links of many2many relations are checked like the records of has many ones, but unlinking only changes the link and doesn't delete
+	rels := append(append([]*schema.Relationship{}, modelSchema.Relationships.HasMany...), modelSchema.Relationships.Many2Many...)
+	for _, rel := range rels {
+		isLink := rel.Type == schema.Many2Many
+		relField := reflect.Indirect(rel.Field.ReflectValueOf(context.Background(), modelVal))
+		if relField.Kind() == reflect.Slice && !relField.IsNil() {
 			len := relField.Len()
 			for i := 0; i < len; i++ {
 				item := relField.Index(i)
+				record := reflect.Indirect(item)
+				if !record.IsValid() {
+					continue
+				}
 				if _, ok := cache[item.Type().String()+"_get"]; !ok {
 					if msg := Get(item.Interface())(c); msg != nil {
 						return msg
 					}
 					cache[item.Type().String()+"_get"] = struct{}{}
 				}
-				if checkDelete {
+				if checkDelete && !isLink {
 					if _, ok := cache[item.Type().String()+"_del"]; !ok {
-						deleteField := item.FieldByName("Delete")
+						deleteField := record.FieldByName("Delete")
 						if deleteField.IsValid() && deleteField.Bool() {
 							if msg := Delete(item.Interface())(c); msg != nil {
 								return msg
@@ -93,7 +100,7 @@ func CheckModel(c *gin.Context, modelVal reflect.Value, modelSchema *schema.Sche
 						}
 					}
 				}
-				msg := CheckModel(c, item, rel.FieldSchema, cache, checkDelete)
+				msg := CheckModel(c, record, rel.FieldSchema, cache, checkDelete)
 				if msg != nil {
 					return msg
 				}
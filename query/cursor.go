@@ -0,0 +1,332 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"api_core/message"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const cursorKeyAlias = "___K%d___"
+
+// MaxCursorLimit is the maximum number of rows of a page with cursor pagination
+var MaxCursorLimit = 1000
+
+type orderTerm struct {
+	Expr string
+	Desc bool
+}
+
+type cursorState struct {
+	terms  []orderTerm
+	values []any
+	prev   bool
+}
+
+// cursorPayload is the content of the opaque cursor, the values of the order terms for the row where the page starts
+type cursorPayload struct {
+	Values []any `json:"v"`
+	Prev   bool  `json:"p,omitempty"`
+}
+
+// ShouldUseCursor reports whether the list is paginated with cursors, requested with limit or cursor instead of pagStart and pagEnd
+func ShouldUseCursor(args *QueryArgs) bool {
+	return !ShouldPaginate(args.PagStart, args.PagEnd) && (args.Limit != "" || args.Cursor != "")
+}
+
+// GetCursorLimit returns the number of rows of the page, 100 by default
+func GetCursorLimit(limit string) int {
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return 100
+	}
+	if n > MaxCursorLimit {
+		return MaxCursorLimit
+	}
+	return n
+}
+
+func cursorKey(i int) string {
+	return strings.Replace(cursorKeyAlias, "%d", strconv.Itoa(i), 1)
+}
+
+/*
+prepareCursor selects the values of the order terms, to be able to build the cursors from the rows.
+The primary keys are added to the order to make it unique, except for DISTINCT queries.
+*/
+func prepareCursor(c *gin.Context, args *QueryArgs, config *QueryConfig) error {
+	info := &args.Info
+	if info.Aggregate {
+		return message.ConflictingPaginationAndAggregation(c)
+	}
+	order := info.Order
+	if info.Distinct && args.Ord == "" {
+		order = ""
+	}
+	terms := parseOrderTerms(order)
+	if !info.Distinct {
+		for _, field := range info.Schema.PrimaryFields {
+			expr := info.Table + "." + field.DBName
+			found := false
+			for _, term := range terms {
+				if term.Expr == expr || term.Expr == info.Table+"."+config.Dialector.EscapeField(field.DBName) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				terms = append(terms, orderTerm{Expr: expr})
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return message.ManualPagination(c)
+	}
+
+	// The aliases can't be referenced in WHERE, they are replaced with the expressions they stand for
+	aliases := map[string]string{}
+	for _, sel := range info.Select {
+		if index := strings.LastIndex(sel, " AS "); index != -1 {
+			aliases[sel[index+4:]] = sel[:index]
+		}
+	}
+	for i, term := range terms {
+		if expr, ok := aliases[term.Expr]; ok {
+			terms[i].Expr = expr
+		} else if expr, ok := aliases[config.Dialector.EscapeField(term.Expr)]; ok {
+			terms[i].Expr = expr
+		}
+		info.Select = append(info.Select, terms[i].Expr+" AS "+config.Dialector.EscapeField(cursorKey(i)))
+		info.Fields = append(info.Fields, reflect.StructField{Name: cursorKey(i), Type: reflect.TypeOf((*any)(nil)).Elem()})
+	}
+
+	state := &cursorState{terms: terms}
+	if args.Cursor != "" {
+		payload, err := decodeCursor(args.Cursor)
+		if err != nil || len(payload.Values) != len(terms) {
+			return message.InvalidUrlParameter(c, "cursor")
+		}
+		state.values = payload.Values
+		state.prev = payload.Prev
+	}
+	args.cursor = state
+	return nil
+}
+
+// applyCursor filters the rows following the cursor, in the order of the page
+func applyCursor(tx *gorm.DB, args *QueryArgs, config QueryConfig) *gorm.DB {
+	state := args.cursor
+	terms := make([]orderTerm, len(state.terms))
+	order := make([]string, len(state.terms))
+	for i, term := range state.terms {
+		// The previous page is read backwards from the cursor and then reversed
+		terms[i] = orderTerm{Expr: term.Expr, Desc: term.Desc != state.prev}
+		order[i] = terms[i].Expr
+		if terms[i].Desc {
+			order[i] += " DESC"
+		}
+	}
+
+	if state.values != nil {
+		nullsFirst := config.Dialector.NullsFirst()
+		conditions := []string{}
+		values := []any{}
+		for i, term := range terms {
+			conds := []string{}
+			for j := 0; j < i; j++ {
+				if state.values[j] == nil {
+					conds = append(conds, terms[j].Expr+" IS NULL")
+				} else {
+					conds = append(conds, terms[j].Expr+" = ?")
+					values = append(values, state.values[j])
+				}
+			}
+			// NULL follows the values when it's sorted last in the direction of the term
+			nullAfter := nullsFirst == term.Desc
+			if state.values[i] == nil {
+				if nullAfter {
+					continue
+				}
+				conds = append(conds, term.Expr+" IS NOT NULL")
+			} else {
+				op := " > ?"
+				if term.Desc {
+					op = " < ?"
+				}
+				if nullAfter {
+					conds = append(conds, "("+term.Expr+op+" OR "+term.Expr+" IS NULL)")
+				} else {
+					conds = append(conds, term.Expr+op)
+				}
+				values = append(values, state.values[i])
+			}
+			conditions = append(conditions, "("+strings.Join(conds, " AND ")+")")
+		}
+		if len(conditions) == 0 {
+			tx = tx.Where("1 = 0")
+		} else {
+			tx = tx.Where("("+strings.Join(conditions, " OR ")+")", values...)
+		}
+	}
+	return tx.Order(strings.Join(order, ",")).Limit(GetCursorLimit(args.Limit) + 1)
+}
+
+// finishCursor trims the rows to the page, generates the cursors and removes the values of the order terms from the result
+func finishCursor(args *QueryArgs) {
+	state := args.cursor
+	limit := GetCursorLimit(args.Limit)
+	more := len(args.Result) > limit
+	if more {
+		args.Result = args.Result[:limit]
+	}
+	if state.prev {
+		for i, j := 0, len(args.Result)-1; i < j; i, j = i+1, j-1 {
+			args.Result[i], args.Result[j] = args.Result[j], args.Result[i]
+		}
+	}
+
+	hasPrev := state.values != nil && (!state.prev || more)
+	hasNext := (state.values != nil && state.prev) || (!state.prev && more)
+	if len(args.Result) > 0 {
+		if hasPrev {
+			args.PrevCursor = encodeCursor(cursorPayload{Values: cursorValues(args.Result[0], len(state.terms)), Prev: true})
+		}
+		if hasNext {
+			args.NextCursor = encodeCursor(cursorPayload{Values: cursorValues(args.Result[len(args.Result)-1], len(state.terms))})
+		}
+	}
+
+	for _, row := range args.Result {
+		for i := range state.terms {
+			delete(row, cursorKey(i))
+		}
+	}
+	fields := args.Info.Fields[:0]
+	for _, field := range args.Info.Fields {
+		if !strings.HasPrefix(field.Name, "___K") {
+			fields = append(fields, field)
+		}
+	}
+	args.Info.Fields = fields
+}
+
+func cursorValues(row map[string]any, n int) []any {
+	values := make([]any, n)
+	for i := range values {
+		val := row[cursorKey(i)]
+		rv := reflect.ValueOf(val)
+		for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+			if rv.IsNil() {
+				break
+			}
+			rv = rv.Elem()
+		}
+		if rv.IsValid() && (rv.Kind() != reflect.Ptr && rv.Kind() != reflect.Interface) {
+			val = rv.Interface()
+		} else {
+			val = nil
+		}
+		if b, ok := val.([]byte); ok {
+			val = string(b)
+		}
+		values[i] = val
+	}
+	return values
+}
+
+// parseOrderTerms splits the ORDER BY clause in its terms, ignoring the commas inside parentheses
+func parseOrderTerms(order string) []orderTerm {
+	terms := []orderTerm{}
+	depth, start := 0, 0
+	split := func(end int) {
+		expr := strings.TrimSpace(order[start:end])
+		if expr == "" {
+			return
+		}
+		term := orderTerm{Expr: expr}
+		upper := strings.ToUpper(expr)
+		if strings.HasSuffix(upper, " DESC") {
+			term = orderTerm{Expr: strings.TrimSpace(expr[:len(expr)-5]), Desc: true}
+		} else if strings.HasSuffix(upper, " ASC") {
+			term.Expr = strings.TrimSpace(expr[:len(expr)-4])
+		}
+		terms = append(terms, term)
+	}
+	for i, r := range order {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				split(i)
+				start = i + 1
+			}
+		}
+	}
+	split(len(order))
+	return terms
+}
+
+// encodeCursor serializes the payload as base64 JSON, times are tagged to be decoded with their type
+func encodeCursor(payload cursorPayload) string {
+	values := make([]any, len(payload.Values))
+	for i, val := range payload.Values {
+		if t, ok := val.(time.Time); ok {
+			values[i] = map[string]string{"t": t.Format(time.RFC3339Nano)}
+		} else {
+			values[i] = val
+		}
+	}
+	data, _ := json.Marshal(cursorPayload{Values: values, Prev: payload.Prev})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (cursorPayload, error) {
+	payload := cursorPayload{}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return payload, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return payload, err
+	}
+	for i, val := range payload.Values {
+		switch v := val.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				payload.Values[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				payload.Values[i] = f
+			} else {
+				return payload, err
+			}
+		case map[string]any:
+			text, ok := v["t"].(string)
+			if !ok {
+				return payload, errors.New("invalid cursor value")
+			}
+			t, err := time.Parse(time.RFC3339Nano, text)
+			if err != nil {
+				return payload, err
+			}
+			payload.Values[i] = t
+		case string, bool, nil:
+		default:
+			return payload, errors.New("invalid cursor value")
+		}
+	}
+	return payload, nil
+}
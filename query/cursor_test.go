@@ -0,0 +1,41 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	when := time.Date(2024, 3, 1, 10, 30, 15, 123456789, time.UTC)
+	tests := []cursorPayload{
+		{Values: []any{int64(42)}},
+		{Values: []any{"A-1", int64(-7)}, Prev: true},
+		{Values: []any{1.5, true, nil}},
+		{Values: []any{when, int64(3)}},
+		{Values: []any{}},
+	}
+	for _, payload := range tests {
+		got, err := decodeCursor(encodeCursor(payload))
+		if err != nil {
+			t.Errorf("decodeCursor(encodeCursor(%v)) error = %v", payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, payload) {
+			t.Errorf("decodeCursor(encodeCursor(%v)) = %v", payload, got)
+		}
+	}
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, cursor := range []string{
+		"not base64!",
+		"bm90IGpzb24",          // not json
+		"eyJ2IjpbeyJ4IjoxfV19", // {"v":[{"x":1}]}
+		"eyJ2IjpbW11dfQ",       // {"v":[[]]}
+	} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) expected an error", cursor)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"api_core/message"
 	"api_core/model"
 	"api_core/params"
+	"api_core/permissions"
 	"api_core/request"
 	"reflect"
 	"regexp"
@@ -26,6 +27,24 @@ type ModelInfo struct {
 	Nested         map[string]NestedModel
 	Aggregate      bool
 	Distinct       bool
+	// Columns lists the selected fields, including the ones of the nested relations, in the order of sel
+	Columns []Column
+}
+
+// Column is a selected field of the result
+type Column struct {
+	// Nested contains the keys of the nested relations containing the field, each in the Nested map of the previous one
+	Nested []string
+	Name   string
+	Field  *schema.Field
+}
+
+// OutputFields returns the fields present in the resulting rows, without the foreign key used to load the nested relations
+func (info *ModelInfo) OutputFields() []reflect.StructField {
+	if len(info.Fields) > 0 && info.Fields[0].Name == fkAlias {
+		return info.Fields[1:]
+	}
+	return info.Fields
 }
 
 func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, modelInfo *ModelInfo, args *QueryArgs, config QueryConfig) message.Message {
@@ -81,6 +100,7 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, mo
 			pieces := strings.Split(field, ".")
 			startIndex := 0
 			key := ""
+			nestedPath := []string{}
 			for i := 0; i < len(pieces)-1; i++ {
 				var nested bool
 				if strings.HasPrefix(pieces[i], ">") {
@@ -129,6 +149,7 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, mo
 							info.Nested[key] = n
 						}
 						startIndex = i + 1
+						nestedPath = append(nestedPath, key)
 						info = info.Nested[key].ModelInfo
 						key = ""
 					}
@@ -148,7 +169,8 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, mo
 				for _, fld := range relSchema.Fields {
 					_, okQ := fld.Tag.Lookup("query")
 					_, okC := fld.Tag.Lookup("compute")
-					if !okQ && !okC {
+					// The wildcard silently excludes the fields that can't be read
+					if !okQ && !okC && permissions.CanRead(c, relSchema, fld) {
 						structFields = append(structFields, fld)
 					}
 				}
@@ -157,6 +179,9 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, mo
 				if fld == nil {
 					return message.InvalidField(c, field)
 				}
+				if !permissions.CanRead(c, relSchema, fld) {
+					return message.UnauthorizedFields(c, field)
+				}
 				if (sum || count) && fieldAlias == "" {
 					fieldAlias = fieldName
 				}
@@ -232,6 +257,7 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, mo
 					}
 					info.Fields = append(info.Fields, structField)
 					info.Select = append(info.Select, sel)
+					modelInfo.Columns = append(modelInfo.Columns, Column{Nested: nestedPath, Name: structField.Name, Field: field})
 				}
 			}
 		}
@@ -241,9 +267,10 @@ func GetModelInfo(c *gin.Context, modelSchema *schema.Schema, selects string, mo
 		}
 	} else {
 		for _, field := range modelSchema.Fields {
-			if field.Readable && len(field.DBName) != 0 {
+			if field.Readable && len(field.DBName) != 0 && permissions.CanRead(c, modelSchema, field) {
 				modelInfo.Fields = append(modelInfo.Fields, field.StructField)
 				modelInfo.Select = append(modelInfo.Select, modelInfo.Table+"."+field.DBName)
+				modelInfo.Columns = append(modelInfo.Columns, Column{Name: field.Name, Field: field})
 			}
 		}
 	}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"strconv"
+	"strings"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -56,3 +57,43 @@ func Paginate(pagStart, pagEnd string) func(*gorm.DB) *gorm.DB {
 		}
 	}
 }
+
+const (
+	CountNone     = "0"
+	CountExact    = "1"
+	CountEstimate = "estimate"
+)
+
+// GetCountMode returns how the total of a paginated list is counted, by default exactly with pagStart and pagEnd and not at all with cursors
+func GetCountMode(args *QueryArgs) string {
+	if args.CountMode != "" {
+		return args.CountMode
+	}
+	if ShouldUseCursor(args) {
+		return CountNone
+	}
+	return CountExact
+}
+
+// countQuery sets the total of the rows in the count mode of the args, it has to be called before the pagination is applied
+func countQuery(tx *gorm.DB, args *QueryArgs, config QueryConfig, info *ModelInfo) error {
+	mode := GetCountMode(args)
+	// The statistics are available only for tables
+	if mode == CountEstimate && (strings.Contains(info.Schema.Table, ") AS ") || len(info.Schema.Table) == 0) {
+		mode = CountExact
+	}
+	switch mode {
+	case CountExact:
+		Count(&args.Count)(tx)
+	case CountEstimate:
+		count, err := config.Dialector.EstimateCount(tx.Session(&gorm.Session{NewDB: true}), info.Schema.Table)
+		if err != nil {
+			return err
+		}
+		args.Count = count
+		args.EstimatedCount = true
+	default:
+		args.Count = -1
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"database/sql"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -29,6 +30,9 @@ type QueryArgs struct {
 	P         string
 	PagStart  string
 	PagEnd    string
+	Limit     string // Limit and Cursor request the cursor pagination, see ShouldUseCursor
+	Cursor    string
+	CountMode string // 0, 1 or estimate, see GetCountMode
 	Ord       string
 	Primaries map[string]interface{}
 	// Model
@@ -36,7 +40,13 @@ type QueryArgs struct {
 	// Output
 	Info   ModelInfo
 	Result []map[string]any
-	Count  int64
+	Count  int64 // -1 when the total hasn't been counted
+	// EstimatedCount reports whether Count is estimated from the statistics of the database
+	EstimatedCount bool
+	// NextCursor and PrevCursor are the cursors of the adjacent pages, empty when there are none
+	NextCursor string
+	PrevCursor string
+	cursor     *cursorState
 }
 
 type QueryConfig struct {
@@ -49,6 +59,97 @@ type QueryConfig struct {
 }
 
 func Query(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig) error {
+	conds, err := prepareQuery(c, db, args, &config)
+	if err != nil {
+		return err
+	}
+
+	args.Result = []map[string]any{}
+	err = QueryRecursive(c, db, args, config, &args.Info, conds, &args.Result)
+	if err != nil {
+		return err
+	}
+
+	if args.cursor != nil {
+		finishCursor(args)
+	} else if !ShouldPaginate(args.PagStart, args.PagEnd) {
+		args.Count = int64(len(args.Result))
+	}
+
+	if len(args.Primaries) != 0 && args.Count == 0 {
+		return message.ItemNotFound(c)
+	}
+
+	return nil
+}
+
+/*
+QueryStream executes the query like Query, but instead of collecting the rows in args.Result it passes them to fn in batches of batchSize.
+The nested relations are loaded for every batch while the rows are being read, so db shouldn't be bound to a single connection.
+*/
+func QueryStream(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig, batchSize int, fn func(rows []map[string]any) error) error {
+	conds, err := prepareQuery(c, db, args, &config)
+	if err != nil {
+		return err
+	}
+
+	tx, err := buildQuery(c, db, args, config, &args.Info, conds)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	addForeignKeyField(&args.Info)
+
+	var total int64
+	batch := make([]map[string]any, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := loadNested(c, db, config, &args.Info, conds, &batch); err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		batch = make([]map[string]any, 0, batchSize)
+		return nil
+	}
+
+	for rows.Next() {
+		rowMap, err := scanRow(rows, &args.Info)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, rowMap)
+		total++
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if !ShouldPaginate(args.PagStart, args.PagEnd) && args.cursor == nil {
+		args.Count = total
+	}
+	return nil
+}
+
+// prepareQuery parses the arguments of the query and returns the conditions to apply
+func prepareQuery(c *gin.Context, db *gorm.DB, args *QueryArgs, config *QueryConfig) (*params.Conditions, error) {
 	if args.Sel != "" {
 		args.Sel = parseSel(args.Sel)
 	}
@@ -61,22 +162,22 @@ func Query(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig) err
 		var err error
 		config.Dialector, err = dialectors.ByDB(db)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	modelSchema, err := schema.Parse(args.Model, &sync.Map{}, db.NamingStrategy)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Obtain all the relations from the arguments
 	// TODO: Extract and validate relations here
 
 	args.Info = ModelInfo{Select: []string{}, SelectArgs: []any{}, Relations: map[string]*params.Conditions{}, Nested: map[string]NestedModel{}, Schema: modelSchema}
-	msg := GetModelInfo(c, modelSchema, getSelect(args.Sel, args.Rel), &args.Info, args, config)
+	msg := GetModelInfo(c, modelSchema, getSelect(args.Sel, args.Rel), &args.Info, args, *config)
 	if msg != nil {
-		return msg
+		return nil, msg
 	}
 
 	if len(args.Primaries) > 0 {
@@ -90,14 +191,14 @@ func Query(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig) err
 	conds := params.Conditions{Nested: map[string]*params.Conditions{}}
 	err = params.ToStmt(c, args.Params, args.P, modelSchema, args.Info.Table, &conds, config.P)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !config.SkipValidation {
 		if err := validateRelations(c, modelSchema, args.Info.Nested); err != nil {
-			return err
+			return nil, err
 		}
 		if err := validateRelations(c, modelSchema, conds.Nested); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -116,24 +217,50 @@ func Query(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig) err
 		args.Info.Order = ""
 	}
 
-	args.Result = []map[string]any{}
-	err = QueryRecursive(c, db, args, config, &args.Info, &conds, &args.Result)
+	switch args.CountMode {
+	case "", CountNone, CountExact, CountEstimate:
+	default:
+		return nil, message.InvalidUrlParameter(c, "count")
+	}
+	if len(args.Primaries) == 0 && ShouldUseCursor(args) {
+		if err := prepareCursor(c, args, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &conds, nil
+}
+
+func QueryRecursive(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig, info *ModelInfo, conds *params.Conditions, result *[]map[string]any) error {
+	tx, err := buildQuery(c, db, args, config, info, conds)
 	if err != nil {
 		return err
 	}
 
-	if !ShouldPaginate(args.PagStart, args.PagEnd) {
-		args.Count = int64(len(args.Result))
+	rows, err := tx.Rows()
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	if len(args.Primaries) != 0 && args.Count == 0 {
-		return message.ItemNotFound(c)
+	addForeignKeyField(info)
+
+	for rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rowMap, err := scanRow(rows, info)
+		if err != nil {
+			return err
+		}
+		*result = append(*result, rowMap)
 	}
 
-	return nil
+	return loadNested(c, db, config, info, conds, result)
 }
 
-func QueryRecursive(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig, info *ModelInfo, conds *params.Conditions, result *[]map[string]any) error {
+// buildQuery prepares the statement selecting the rows of the model described by info
+func buildQuery(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryConfig, info *ModelInfo, conds *params.Conditions) (*gorm.DB, error) {
 	tx := db.Select(strings.Join(info.Select, ","), info.SelectArgs...)
 	tx.Statement.Distinct = info.Distinct
 	if info.Aggregate {
@@ -189,18 +316,28 @@ func QueryRecursive(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryCo
 			// }
 
 			if info.Aggregate && pagination {
-				return message.ConflictingPaginationAndAggregation(c)
+				return nil, message.ConflictingPaginationAndAggregation(c)
 			}
 			if info.Distinct && args.Ord == "" {
 				order = ""
 			}
-			if len(order) > 0 {
+			if args.cursor != nil {
+				if err := countQuery(tx, args, config, info); err != nil {
+					return nil, err
+				}
+				tx = applyCursor(tx, args, config)
+			} else if len(order) > 0 {
 				if !info.Aggregate && pagination {
-					tx = tx.Scopes(Count(&args.Count)).Scopes(Paginate(args.PagStart, args.PagEnd))
+					if GetCountMode(args) == CountExact {
+						tx = tx.Scopes(Count(&args.Count))
+					} else if err := countQuery(tx, args, config, info); err != nil {
+						return nil, err
+					}
+					tx = tx.Scopes(Paginate(args.PagStart, args.PagEnd))
 				}
 				tx = tx.Order(order)
 			} else if pagination {
-				return message.ManualPagination(c)
+				return nil, message.ManualPagination(c)
 			}
 		} else {
 			tx = tx.Where(args.Primaries)
@@ -222,12 +359,11 @@ func QueryRecursive(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryCo
 		//	tx.Statement.Clauses[n] = ord
 	}
 
-	rows, err := tx.Rows()
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
+	return tx, nil
+}
 
+// addForeignKeyField adds the foreign key selected for the nested relations to the fields
+func addForeignKeyField(info *ModelInfo) {
 	// Add the foreign key to the fields for now
 	if len(info.Select) != len(info.Fields) {
 		info.Fields = append([]reflect.StructField{{
@@ -235,47 +371,48 @@ func QueryRecursive(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryCo
 			Type: reflect.TypeOf(""),
 		}}, info.Fields...)
 	}
+}
 
-	for rows.Next() {
-		if err := rows.Err(); err != nil {
-			return err
-		}
-		rowFields := make([]any, len(info.Fields))
-		for i := 0; i < len(rowFields); i++ {
-			// t := info.Fields[i].Type
-			// if t.Kind() == reflect.Pointer {
-			// 	t = t.Elem()
-			// }
-			// switch t.Kind() {
-			// case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
-			// 	rowFields[i] = new(int)
-			// case reflect.Float32, reflect.Float64:
-			// 	rowFields[i] = new(float64)
-			// case reflect.String:
-			// 	rowFields[i] = new(string)
-			// default:
-			// 	rowFields[i] = reflect.New(t).Interface()
-			// }
-
-			t := info.Fields[i].Type
-			if t.Kind() != reflect.Pointer {
-				t = reflect.PointerTo(t)
-			}
-			rowFields[i] = reflect.New(t).Interface()
-		}
-
-		if err := rows.Scan(rowFields...); err != nil {
-			return err
+// scanRow reads the current row in a map keyed by field name
+func scanRow(rows *sql.Rows, info *ModelInfo) (map[string]any, error) {
+	rowFields := make([]any, len(info.Fields))
+	for i := 0; i < len(rowFields); i++ {
+		// t := info.Fields[i].Type
+		// if t.Kind() == reflect.Pointer {
+		// 	t = t.Elem()
+		// }
+		// switch t.Kind() {
+		// case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		// 	rowFields[i] = new(int)
+		// case reflect.Float32, reflect.Float64:
+		// 	rowFields[i] = new(float64)
+		// case reflect.String:
+		// 	rowFields[i] = new(string)
+		// default:
+		// 	rowFields[i] = reflect.New(t).Interface()
+		// }
+
+		t := info.Fields[i].Type
+		if t.Kind() != reflect.Pointer {
+			t = reflect.PointerTo(t)
 		}
+		rowFields[i] = reflect.New(t).Interface()
+	}
 
-		rowMap := make(map[string]any, len(info.Fields))
-		for i := 0; i < len(rowFields); i++ {
-			rowMap[info.Fields[i].Name] = reflect.ValueOf(rowFields[i]).Elem().Interface()
-		}
+	if err := rows.Scan(rowFields...); err != nil {
+		return nil, err
+	}
 
-		*result = append(*result, rowMap)
+	rowMap := make(map[string]any, len(info.Fields))
+	for i := 0; i < len(rowFields); i++ {
+		rowMap[info.Fields[i].Name] = reflect.ValueOf(rowFields[i]).Elem().Interface()
 	}
 
+	return rowMap, nil
+}
+
+// loadNested evaluates the computed fields and loads the nested relations of the rows
+func loadNested(c *gin.Context, db *gorm.DB, config QueryConfig, info *ModelInfo, conds *params.Conditions, result *[]map[string]any) error {
 	// Computed fields
 
 	for _, computedField := range info.ComputedFields {
@@ -301,7 +438,9 @@ func QueryRecursive(c *gin.Context, db *gorm.DB, args *QueryArgs, config QueryCo
 		nestedConds := &params.Conditions{}
 		if conds.Nested != nil {
 			if c, ok := conds.Nested[relName]; ok && (c.Type == "N" || c.Type == "M") {
-				nestedConds = c
+				// The conditions are copied, since the key set is appended to them for every set of rows
+				copied := *c
+				nestedConds = &copied
 			}
 		}
 
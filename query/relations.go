@@ -9,6 +9,7 @@ import (
 	"api_core/message"
 	"api_core/model"
 	"api_core/params"
+	"api_core/permissions"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -159,6 +160,9 @@ func ParseOrder(c *gin.Context, order string, info *ModelInfo, config QueryConfi
 				fldName := strings.TrimSuffix(strings.TrimSuffix(field, " DESC"), " ASC")
 				piece := strings.TrimSuffix(strings.TrimSuffix(pieces[len(pieces)-1], " DESC"), " ASC")
 				fld := relSchema.LookUpField(piece)
+				if fld != nil && !permissions.CanRead(c, relSchema, fld) {
+					return message.UnauthorizedFields(c, fldName)
+				}
 				if fld == nil {
 					search := config.Dialector.EscapeField(piece)
 					found := false
@@ -1,6 +1,8 @@
 package request
 
 import (
+	"log/slog"
+
 	"api_core/app"
 
 	"github.com/gin-gonic/gin"
@@ -19,10 +21,19 @@ func Gin(db *gorm.DB) *gin.Context {
 	return GinGetter(db)
 }
 
+// DB returns the database of the request, or the transaction the request is running in when one has been set with WithTx
 func DB(c *gin.Context) *gorm.DB {
+	if tx, ok := c.Get(TxKey); ok {
+		return tx.(*gorm.DB)
+	}
 	return DBGetter(c)
 }
 
+// WithTx makes every database operation of the request run inside the transaction
+func WithTx(c *gin.Context, tx *gorm.DB) {
+	c.Set(TxKey, tx)
+}
+
 func I18n(c *gin.Context) *message.Printer {
 	return I18nGetter(c)
 }
@@ -31,11 +42,26 @@ func Session(c *gin.Context) *app.Session {
 	return SessionGetter(c)
 }
 
+// RequestID returns the identifier of the request, as assigned in the context or sent in the X-Request-ID header
+func RequestID(c *gin.Context) string {
+	if id := c.GetString(RequestIDKey); id != "" {
+		return id
+	}
+	return c.GetHeader("X-Request-ID")
+}
+
+// Logger returns the logger of the request, which carries its request ID when assigned by the RequestID middleware
+func Logger(c *gin.Context) *slog.Logger {
+	return app.LoggerFrom(c)
+}
+
 type DbContextKey string
 
 var (
-	GinKey     DbContextKey = "gin"
-	DBKey      string       = "db"
-	I18nKey    string       = "i18n"
-	SessionKey string       = "s"
+	GinKey       DbContextKey = "gin"
+	DBKey        string       = "db"
+	I18nKey      string       = "i18n"
+	SessionKey   string       = "s"
+	RequestIDKey string       = "requestId"
+	TxKey        string       = "tx"
 )
@@ -0,0 +1,171 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xmlWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xmlRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xmlSharedStrings struct {
+	Items []xmlRichText `xml:"si"`
+}
+
+type xmlRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xmlRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.Text)
+	}
+	return sb.String()
+}
+
+type xmlSheet struct {
+	Rows []struct {
+		Index int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string      `xml:"r,attr"`
+			Type   string      `xml:"t,attr"`
+			Value  string      `xml:"v"`
+			Inline xmlRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadRows returns the cells of the first sheet of the workbook as text, booleans are returned as 0/1 and dates as serial numbers
+func ReadRows(r io.ReaderAt, size int64) ([][]string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	sheetPath := "xl/worksheets/sheet1.xml"
+	workbook := xmlWorkbook{}
+	rels := xmlRelationships{}
+	if decodeFile(files["xl/workbook.xml"], &workbook) == nil && decodeFile(files["xl/_rels/workbook.xml.rels"], &rels) == nil && len(workbook.Sheets) > 0 {
+		for _, rel := range rels.Relationships {
+			if rel.ID == workbook.Sheets[0].RID {
+				if strings.HasPrefix(rel.Target, "/") {
+					sheetPath = strings.TrimPrefix(rel.Target, "/")
+				} else {
+					sheetPath = path.Join("xl", rel.Target)
+				}
+			}
+		}
+	}
+
+	shared := xmlSharedStrings{}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeFile(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet := xmlSheet{}
+	if err := decodeFile(files[sheetPath], &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for _, row := range sheet.Rows {
+		index := row.Index - 1
+		if index < len(rows) {
+			index = len(rows)
+		}
+		for len(rows) < index {
+			rows = append(rows, []string{})
+		}
+		cells := []string{}
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = ColumnIndex(cell.Ref)
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			var value string
+			switch cell.Type {
+			case "s":
+				if i, err := strconv.Atoi(cell.Value); err == nil && i < len(shared.Items) {
+					value = shared.Items[i].String()
+				}
+			case "inlineStr":
+				value = cell.Inline.String()
+			default:
+				value = cell.Value
+			}
+			cells = append(cells, value)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// ColumnIndex returns the zero based index of the column of a cell reference, e.g. 2 for C7
+func ColumnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1
+}
+
+// ParseSerial converts an Excel serial date number to time
+func ParseSerial(serial string) (time.Time, error) {
+	value, err := strconv.ParseFloat(serial, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	days := int(value)
+	seconds := int((value-float64(days))*86400 + 0.5)
+	return excelEpoch.AddDate(0, 0, days).Add(time.Duration(seconds) * time.Second), nil
+}
+
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+func decodeFile(f *zip.File, v any) error {
+	if f == nil {
+		return errors.New("xlsx: missing part")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
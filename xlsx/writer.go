@@ -0,0 +1,294 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is written as a date cell without the time
+type Date time.Time
+
+// Sheet is a worksheet of a Workbook, its first row is the header, which is frozen and filterable
+type Sheet struct {
+	Name string
+	Rows [][]any
+}
+
+// AddRow appends a row, values can be strings, numbers, booleans, time.Time, Date or nil for empty cells
+func (s *Sheet) AddRow(values ...any) {
+	s.Rows = append(s.Rows, values)
+}
+
+type Workbook struct {
+	Sheets []*Sheet
+}
+
+func NewWorkbook() *Workbook {
+	return &Workbook{}
+}
+
+// AddSheet appends a sheet, the name is adapted to the restrictions of Excel and made unique
+func (w *Workbook) AddSheet(name string) *Sheet {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+	unique := truncate(name, 31)
+	for i := 2; w.sheet(unique) != nil; i++ {
+		suffix := " (" + strconv.Itoa(i) + ")"
+		unique = truncate(name, 31-len(suffix)) + suffix
+	}
+	sheet := &Sheet{Name: unique}
+	w.Sheets = append(w.Sheets, sheet)
+	return sheet
+}
+
+func (w *Workbook) sheet(name string) *Sheet {
+	for _, s := range w.Sheets {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Write writes the workbook in the Office Open XML format
+func (w *Workbook) Write(out io.Writer) error {
+	if len(w.Sheets) == 0 {
+		w.AddSheet("Sheet")
+	}
+	archive := zip.NewWriter(out)
+
+	var contentTypes, workbook, rels strings.Builder
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	var definedNames strings.Builder
+	for i, sheet := range w.Sheets {
+		id := strconv.Itoa(i + 1)
+		contentTypes.WriteString(`<Override PartName="/xl/worksheets/sheet` + id + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		workbook.WriteString(`<sheet name="` + escape(sheet.Name) + `" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + id + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + id + `.xml"/>`)
+		if ref := sheet.filterRef(true); ref != "" {
+			definedNames.WriteString(`<definedName name="_xlnm._FilterDatabase" localSheetId="` + strconv.Itoa(i) + `" hidden="1">` + escape("'"+strings.ReplaceAll(sheet.Name, "'", "''")+"'!"+ref) + `</definedName>`)
+		}
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets>`)
+	if definedNames.Len() > 0 {
+		workbook.WriteString(`<definedNames>` + definedNames.String() + `</definedNames>`)
+	}
+	workbook.WriteString(`</workbook>`)
+	rels.WriteString(`<Relationship Id="rId` + strconv.Itoa(len(w.Sheets)+1) + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", styles},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	for i, sheet := range w.Sheets {
+		f, err := archive.Create("xl/worksheets/sheet" + strconv.Itoa(i+1) + ".xml")
+		if err != nil {
+			return err
+		}
+		if err := sheet.write(f); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Cell styles, in the order of cellXfs
+const (
+	styleDefault = iota
+	styleDate
+	styleDatetime
+	styleHeader
+)
+
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// filterRef returns the range of the autofilter, the whole table starting from the header
+func (s *Sheet) filterRef(absolute bool) string {
+	cols := 0
+	for _, row := range s.Rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	if cols == 0 {
+		return ""
+	}
+	if absolute {
+		return "$A$1:$" + ColumnName(cols-1) + "$" + strconv.Itoa(len(s.Rows))
+	}
+	return "A1:" + ColumnName(cols-1) + strconv.Itoa(len(s.Rows))
+}
+
+func (s *Sheet) write(out io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sb.WriteString(`<sheetData>`)
+	for i, row := range s.Rows {
+		r := strconv.Itoa(i + 1)
+		sb.WriteString(`<row r="` + r + `">`)
+		for j, value := range row {
+			style := styleDefault
+			if i == 0 {
+				style = styleHeader
+			}
+			writeCell(&sb, ColumnName(j)+r, value, style)
+		}
+		sb.WriteString(`</row>`)
+		if sb.Len() > 1<<16 {
+			if _, err := io.WriteString(out, sb.String()); err != nil {
+				return err
+			}
+			sb.Reset()
+		}
+	}
+	sb.WriteString(`</sheetData>`)
+	if ref := s.filterRef(false); ref != "" {
+		sb.WriteString(`<autoFilter ref="` + ref + `"/>`)
+	}
+	sb.WriteString(`</worksheet>`)
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+func writeCell(sb *strings.Builder, ref string, value any, style int) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return
+	case time.Time:
+		writeNumber(sb, ref, Serial(v), styleDatetime)
+		return
+	case Date:
+		writeNumber(sb, ref, Serial(time.Time(v)), styleDate)
+		return
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		rv := reflect.ValueOf(value)
+		for rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return
+			}
+			rv = rv.Elem()
+			value = rv.Interface()
+		}
+		switch rv.Kind() {
+		case reflect.Bool:
+			b := "0"
+			if rv.Bool() {
+				b = "1"
+			}
+			sb.WriteString(`<c r="` + ref + `"` + styleAttr(style) + ` t="b"><v>` + b + `</v></c>`)
+			return
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			writeNumber(sb, ref, strconv.FormatInt(rv.Int(), 10), style)
+			return
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			writeNumber(sb, ref, strconv.FormatUint(rv.Uint(), 10), style)
+			return
+		case reflect.Float32:
+			writeNumber(sb, ref, strconv.FormatFloat(rv.Float(), 'f', -1, 32), style)
+			return
+		case reflect.Float64:
+			writeNumber(sb, ref, strconv.FormatFloat(rv.Float(), 'f', -1, 64), style)
+			return
+		case reflect.String:
+			s = rv.String()
+		default:
+			if rv.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
+				writeCell(sb, ref, rv.Convert(reflect.TypeOf(time.Time{})).Interface(), style)
+				return
+			}
+			s = fmt.Sprint(value)
+		}
+	}
+	sb.WriteString(`<c r="` + ref + `"` + styleAttr(style) + ` t="inlineStr"><is><t xml:space="preserve">` + escape(s) + `</t></is></c>`)
+}
+
+func writeNumber(sb *strings.Builder, ref string, number string, style int) {
+	sb.WriteString(`<c r="` + ref + `"` + styleAttr(style) + `><v>` + number + `</v></c>`)
+}
+
+func styleAttr(style int) string {
+	if style == styleDefault {
+		return ""
+	}
+	return ` s="` + strconv.Itoa(style) + `"`
+}
+
+// ColumnName returns the name of the column with the zero based index, e.g. C for 2
+func ColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// Serial converts a time to an Excel serial date number, the time is written as it is in its location
+func Serial(t time.Time) string {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return strconv.FormatFloat(wall.Sub(excelEpoch).Hours()/24, 'f', -1, 64)
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return s
+}